@@ -1,33 +1,233 @@
-package main
+package refret
 
-import "path"
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Operation identifies the kind of action to be taken on a file system.
+type Operation string
+
+// Supported operations
+const (
+	RenameOperation Operation = "rename" // Rename OldPath to NewPath
+	MkdirOperation  Operation = "mkdir"  // Create a directory at NewPath
+	RmdirOperation  Operation = "rmdir"  // Remove an empty directory at OldPath
+)
+
+// Reverse returns the operation that reverses op.
+func (op Operation) Reverse() Operation {
+	switch op {
+	case MkdirOperation:
+		return RmdirOperation
+	case RmdirOperation:
+		return MkdirOperation
+	default:
+		return op
+	}
+}
 
 // Action describes a proposed action on a file system.
+//
+// An action with an empty operation is treated as a rename, for
+// compatibility with files that lack an operation column. The rule that
+// proposed a rename is recorded for review, and is ignored when the action
+// is carried out.
 type Action struct {
 	OldPath string
 	NewPath string
+	Op      Operation
+	Rule    string
+	Row     int `csv:"-"` // The row of the file the action was read from, if any
+}
+
+// Operation returns the operation to be performed by the action.
+func (a Action) Operation() Operation {
+	if a.Op == "" {
+		return RenameOperation
+	}
+	return a.Op
 }
 
 // String returns a string representation of the action.
 func (a Action) String() string {
-	return a.OldPath + " → " + a.NewPath
+	switch a.Operation() {
+	case MkdirOperation:
+		return "mkdir " + a.NewPath
+	case RmdirOperation:
+		return "rmdir " + a.OldPath
+	default:
+		return a.OldPath + " → " + a.NewPath
+	}
 }
 
 // BuildActions prepares a set of actions to be taken on a set of files that
 // have been scanned. All file operations that match the requested patterns
 // and are actionable will be included.
-func BuildActions(files []File) (actions []Action) {
-	filter := func(file File) bool {
-		return file.Result == Matched
+//
+// Substitutions may produce names that contain slashes, which move files
+// into subdirectories. Any subdirectories that are missing are created by
+// mkdir actions that precede the first action that needs them.
+//
+// Actions are ordered so that the contents of each directory are renamed
+// before the directory itself. Within a directory, actions are ordered so
+// that no file is renamed to a name that is still in use by a sibling that
+// is waiting to be renamed. Cycles among siblings, such as swapped names,
+// are broken by moving one of the files to a temporary name first.
+//
+// Names are compared according to the case sensitivity of the file system.
+// Renames that only change the case of a name do not depend on themselves;
+// they are carried out in two steps by process.
+func BuildActions(files []File, cs CaseSensitivity) (actions []Action) {
+	for _, file := range files {
+		if file.Result == Matched {
+			actions = append(actions, BuildActions(file.Contents, cs)...)
+		}
 	}
-	action := func(file File) {
-		if file.Actionable() {
-			actions = append(actions, Action{
-				OldPath: path.Join(file.Parent, file.Name),
-				NewPath: path.Join(file.Parent, file.NewName),
-			})
+	return append(actions, orderActions(files, cs)...)
+}
+
+// orderActions returns the actions for a set of sibling files, ordered so
+// that they can be safely performed in series.
+func orderActions(siblings []File, cs CaseSensitivity) (actions []Action) {
+	// Collect the actionable files and index them by name
+	var pending []File
+	sources := make(map[string]int)
+	for _, file := range siblings {
+		if file.Result == Matched && file.Actionable() {
+			sources[cs.Key(file.Name)] = len(pending)
+			pending = append(pending, file)
 		}
 	}
-	walkAscending(files, filter, action)
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// Emit each action after the directories it needs
+	created := make(map[string]bool)
+	emit := func(file File, oldName, newName string) {
+		actions = append(actions, makeParents(siblings, file.Parent, newName, created, cs)...)
+		actions = append(actions, Action{
+			OldPath: path.Join(file.Parent, oldName),
+			NewPath: path.Join(file.Parent, newName),
+			Op:      RenameOperation,
+			Rule:    file.Rule,
+		})
+	}
+
+	// Each action depends on at most one other action: the one that moves
+	// the file currently occupying its target out of the way. Follow each
+	// chain of dependencies until it ends or loops back on itself, then
+	// perform it in reverse.
+	done := make([]bool, len(pending))
+	for start := range pending {
+		if done[start] {
+			continue
+		}
+		chain := []int{start}
+		seen := map[int]int{start: 0}
+		cycle := -1
+		for {
+			last := chain[len(chain)-1]
+			next, ok := sources[cs.Key(pending[last].NewName)]
+			if !ok || done[next] || next == last {
+				break
+			}
+			if pos, looped := seen[next]; looped {
+				cycle = pos
+				break
+			}
+			seen[next] = len(chain)
+			chain = append(chain, next)
+		}
+
+		// Without a cycle, perform the chain from its end
+		if cycle < 0 {
+			for i := len(chain) - 1; i >= 0; i-- {
+				emit(pending[chain[i]], pending[chain[i]].Name, pending[chain[i]].NewName)
+				done[chain[i]] = true
+			}
+			continue
+		}
+
+		// With a cycle, move the first file in the cycle to a temporary
+		// name, perform the rest of the cycle, then move the first file
+		// from its temporary name to its target
+		first := pending[chain[cycle]]
+		temp := tempName(siblings, first.Name, cs)
+		emit(first, first.Name, temp)
+		for i := len(chain) - 1; i > cycle; i-- {
+			emit(pending[chain[i]], pending[chain[i]].Name, pending[chain[i]].NewName)
+			done[chain[i]] = true
+		}
+		emit(first, temp, first.NewName)
+		done[chain[cycle]] = true
+		for i := cycle - 1; i >= 0; i-- {
+			emit(pending[chain[i]], pending[chain[i]].Name, pending[chain[i]].NewName)
+			done[chain[i]] = true
+		}
+	}
+
+	return actions
+}
+
+// makeParents returns mkdir actions for each of the parent directories of
+// name that are missing from dir. Directories that are already recorded in
+// created are skipped, and new ones are added to it.
+//
+// A parent directory is considered present if it is the name of a sibling or
+// it was found within the scanned contents of a sibling. Directories that
+// were not scanned are assumed to be empty.
+func makeParents(siblings []File, dir, name string, created map[string]bool, cs CaseSensitivity) (actions []Action) {
+	var parents []string
+	for parent := path.Dir(name); parent != "." && parent != "/"; parent = path.Dir(parent) {
+		parents = append(parents, parent)
+	}
+	for i := len(parents) - 1; i >= 0; i-- {
+		parent := parents[i]
+		if created[cs.Key(parent)] || findFile(siblings, parent, cs) != nil {
+			continue
+		}
+		created[cs.Key(parent)] = true
+		actions = append(actions, Action{
+			NewPath: path.Join(dir, parent),
+			Op:      MkdirOperation,
+		})
+	}
 	return actions
 }
+
+// findFile returns the file with the given slash-separated path relative to
+// a set of sibling files, or nil if no such file was scanned.
+func findFile(siblings []File, p string, cs CaseSensitivity) *File {
+	first, rest := p, ""
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		first, rest = p[:i], p[i+1:]
+	}
+	for i := range siblings {
+		if cs.Key(siblings[i].Name) != cs.Key(first) {
+			continue
+		}
+		if rest == "" {
+			return &siblings[i]
+		}
+		return findFile(siblings[i].Contents, rest, cs)
+	}
+	return nil
+}
+
+// tempName returns a temporary name for a file that does not conflict with
+// the current or proposed names of any of its siblings.
+func tempName(siblings []File, name string, cs CaseSensitivity) string {
+	taken := make(map[string]bool, len(siblings)*2)
+	for _, file := range siblings {
+		taken[cs.Key(file.Name)] = true
+		taken[cs.Key(file.NewName)] = true
+	}
+	temp := name + ".refret-swap"
+	for i := 2; taken[cs.Key(temp)]; i++ {
+		temp = name + ".refret-swap-" + strconv.Itoa(i)
+	}
+	return temp
+}
@@ -0,0 +1,118 @@
+package refret
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// CaseSensitivity describes how a file system compares file names.
+type CaseSensitivity int
+
+// File system case sensitivity
+const (
+	CaseSensitive   CaseSensitivity = 0
+	CaseInsensitive CaseSensitivity = 1
+)
+
+// Key returns a key for name that can be used to determine whether two names
+// refer to the same file.
+func (cs CaseSensitivity) Key(name string) string {
+	if cs == CaseInsensitive {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// String returns a string representation of cs.
+func (cs CaseSensitivity) String() string {
+	if cs == CaseInsensitive {
+		return "Case-Insensitive"
+	}
+	return "Case-Sensitive"
+}
+
+// ProbeCaseSensitivity determines the case sensitivity of fsys by looking
+// up one of the scanned files with the case of its name swapped. It does not
+// modify the file system.
+//
+// It returns false if none of the files have names that can be swapped.
+func ProbeCaseSensitivity(fsys fs.FS, files []File) (cs CaseSensitivity, determined bool, err error) {
+	var candidate *File
+	filter := func(file File) bool {
+		return candidate == nil
+	}
+	action := func(file File) {
+		if candidate == nil && swapCase(file.Name) != file.Name {
+			candidate = &file
+		}
+	}
+	walkDescending(files, filter, action)
+	if candidate == nil {
+		return CaseSensitive, false, nil
+	}
+
+	return probeCase(fsys, path.Join(candidate.Parent, candidate.Name))
+}
+
+// ProbePlanCaseSensitivity determines the case sensitivity of fsys in the
+// same way as ProbeCaseSensitivity, by looking up the source of one of the
+// given actions. Sources that don't exist are skipped.
+//
+// It returns false if none of the sources have names that can be swapped.
+func ProbePlanCaseSensitivity(fsys fs.FS, actions []Action) (cs CaseSensitivity, determined bool, err error) {
+	for _, action := range actions {
+		p := action.OldPath
+		if !fs.ValidPath(p) || p == "." || swapCase(path.Base(p)) == path.Base(p) {
+			continue
+		}
+		cs, determined, err := probeCase(fsys, p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return cs, determined, err
+	}
+	return CaseSensitive, false, nil
+}
+
+// probeCase determines the case sensitivity of fsys by looking up the file
+// at p with the case of its name swapped.
+func probeCase(fsys fs.FS, p string) (cs CaseSensitivity, determined bool, err error) {
+	original, err := fs.Stat(fsys, p)
+	if err != nil {
+		return CaseSensitive, false, err
+	}
+	swapped, err := fs.Stat(fsys, path.Join(path.Dir(p), swapCase(path.Base(p))))
+	switch {
+	case os.IsNotExist(err):
+		return CaseSensitive, true, nil
+	case err != nil:
+		return CaseSensitive, false, err
+	case os.SameFile(original, swapped):
+		return CaseInsensitive, true, nil
+	default:
+		return CaseSensitive, true, nil
+	}
+}
+
+// isCaseOnly returns true if the only difference between two names is the
+// case of their letters.
+func isCaseOnly(a, b string) bool {
+	return a != b && strings.EqualFold(a, b)
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsUpper(r):
+			return unicode.ToLower(r)
+		case unicode.IsLower(r):
+			return unicode.ToUpper(r)
+		default:
+			return r
+		}
+	}, s)
+}
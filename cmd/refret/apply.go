@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gentlemanautomaton/refret"
+)
+
+// apply reads a plan of proposed actions, validates it against the file
+// system and, if requested, carries it out.
+func apply(ctx context.Context, conf ApplyConfig) {
+	fmt.Println(conf.Summary())
+
+	// Read the plan
+	fmt.Printf("Reading plan from %s...", conf.Plan)
+	actions, err := refret.ReadActions(conf.Plan)
+	if err != nil {
+		fmt.Printf(" failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(" done.\n")
+
+	if len(actions) == 0 {
+		fmt.Printf("No actions planned.\n")
+		return
+	}
+
+	// Make sure every action in the plan is valid
+	cs := probePlanCase(conf.Root, actions)
+	fmt.Printf("Validating plan...")
+	problems, err := refret.ValidatePlan(conf.Root, cs, actions, nil)
+	if err != nil {
+		fmt.Printf(" failed: %v\n", err)
+		os.Exit(1)
+	}
+	if len(problems) > 0 {
+		fmt.Printf(" failed: %s found.\n", pluralize(len(problems), "problem", "problems"))
+		for _, problem := range problems {
+			fmt.Printf("  %s\n", problem)
+		}
+		os.Exit(1)
+	}
+	fmt.Print(" done.\n")
+
+	// Print a summary of the planned actions
+	fmt.Printf("%s planned.\n", pluralize(len(actions), "action", "actions"))
+
+	// If the user hasn't opted-in to renaming things, stop now
+	if !conf.Proceed {
+		return
+	}
+
+	// Perform the actions
+	resultsFileName := filepath.Join(conf.OutputDir, fmt.Sprintf("%s-results %s.tsv", conf.FileNamePrefix, currentTimestamp()))
+	execute(ctx, "rename", resultsFileName, conf.Root, conf.Confirmation, nil, nil, actions)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gentlemanautomaton/refret"
+)
+
+const description = "Searches for and optionally renames files according to regular expression patterns. " +
+	"It matches file and directory names as it traverses a file system from a given root. " +
+	"Successive patterns match successive traversal depths. " +
+	"A ** pattern matches any number of intermediate directories, including none.\n\n" +
+	"Proposed rename actions, omitted (non-matching) files and the results of actions taken are logged for inspection and review.\n\n" +
+	"During evaluation, files are scanned concurrently for speed. Rename operations happen in series for safety."
+
+// CLI holds the set of commands that can be invoked from the command line.
+type CLI struct {
+	Rename Config       `kong:"cmd,name='rename',help='Search for and optionally rename files according to regular expression patterns. This is the default command.'"`
+	Apply  ApplyConfig  `kong:"cmd,name='apply',help='Carry out the actions in a proposed actions file.'"`
+	Resume ResumeConfig `kong:"cmd,name='resume',help='Carry out the actions in a proposed actions file that have not yet succeeded.'"`
+	Undo   UndoConfig   `kong:"cmd,name='undo',help='Reverse the successful actions recorded in a results file.'"`
+}
+
+// Config holds configuration values for the rename command, ingested from
+// the environment, the command line and an optional configuration file.
+type Config struct {
+	ConfigFile     string                   `kong:"env='CONFIG',name='config',help='JSON configuration file providing default values for the root, name, patterns, patterns-file, concurrency, output-dir, case-sensitive, probe-case, simulate, proceed, yes and expect-actions options. Relative paths are resolved against the directory of the file. Flags and environment variables take precedence.'"`
+	FileNamePrefix string                   `kong:"env='NAME',name='name',default='migration',required,help='Output file name prefix.'"`
+	OutputDir      string                   `kong:"env='OUTPUT_DIR',name='output-dir',help='Directory in which output files are written.'"`
+	Root           string                   `kong:"env='ROOT',name='root',help='Root path of the file directory structure.'"`
+	Patterns       []refret.Pattern         `kong:"env='PATTERN',name='pattern',arg,optional,help='Regular expression patterns to match, with an optional substitution delimited by a forward slash (exp/sub) or written with flags as sed:s|exp|sub|flags, where the bar may be any of /|#!,:;@%~=. Delimiters may be escaped with a backslash. Substitutions may contain further slashes to move files into subdirectories, may convert case with \\U, \\L, \\u, \\l and \\E, and may include placeholders such as {n}, {mtime:2006-01-02}, {size}, {base} and {ext}. Flags may be i (case-insensitive) or c (case-sensitive), and are only recognized in the sed: form. Expressions prefixed with glob: are globs supporting *, ?, [0-9] and {a,b}, whose *, ? and [...] wildcards may be referenced as $1, $2 and so on. Braces are not numbered. A pattern of ** matches zero or more directory levels.'"`
+	PatternsFile   string                   `kong:"env='PATTERNS_FILE',name='patterns-file',help='JSON, YAML or TOML file describing the pattern for each depth, used instead of pattern arguments. The format is chosen by the file extension (.json, .yaml, .yml or .toml). Its SHA-256 hash is recorded in each output file.'"`
+	Map            string                   `kong:"env='MAP',name='map',help='TSV or CSV mapping table with Old and New columns, whose new names are applied to the names at the mapping depth. Names without an entry are not matched.'"`
+	MapDepth       int                      `kong:"env='MAP_DEPTH',name='map-depth',help='Depth at which the mapping table is applied.'"`
+	MapKey         string                   `kong:"env='MAP_KEY',name='map-key',help='Regular expression that extracts the key to look up in the mapping table from each name, using its first capture group if it has one. Only the key is replaced. By default, whole names are looked up.'"`
+	Rules          []refret.DepthRule       `kong:"env='RULES',name='rule',sep='none',help='Alternative rules for the pattern at a position (position:pattern), such as 1:^Copy of (.*)/$1. Rules are tried in order after the pattern itself, which must have an expression unless the position is chained.'"`
+	Chain          []int                    `kong:"env='CHAIN',name='chain',help='Positions at which every matching rule is applied in turn, rather than only the first.'"`
+	Exclude        []refret.Exclusion       `kong:"env='EXCLUDE',name='exclude',sep='none',help='Regular expressions for names that are never matched at any depth. Excluded directories are not traversed.'"`
+	ExcludeAt      []refret.DepthExclusion  `kong:"env='EXCLUDE_AT',name='exclude-at',sep='none',help='Regular expressions for names that are not matched by the pattern at a position (position:exp), such as 0:^(Archive|\\.snapshot)$.'"`
+	Where          []refret.DepthConditions `kong:"env='WHERE',name='where',sep='none',help='Conditions on file metadata that files matching the pattern at a position must satisfy (position:conditions), such as 1:type=dir,mtime<2020-01-01. Supported conditions are type, size, mtime and perm.'"`
+	CaseSensitive  bool                     `kong:"env='CASE_SENSITIVE',name='case-sensitive',help='Match patterns case-sensitively unless their flags specify otherwise.'"`
+	Verbose        bool                     `kong:"env='VERBOSE',name='verbose',short='v',help='Provide verbose output.'"`
+	Matched        bool                     `kong:"env='MATCHED',name='matched',short='m',help='Show matching files and directories.'"`
+	Unmatched      bool                     `kong:"env='UNMATCHED',name='unmatched',short='u',help='Show non-matching files and directories.'"`
+	Concurrency    int                      `kong:"env='CONCURRENCY',name='concurrency',short='c',default='32',help='Maximum number of concurrent read operations during scanning.'"`
+	ProbeCase      bool                     `kong:"env='PROBE_CASE',name='probe-case',help='Probe the file system to determine whether its file names are case-sensitive.'"`
+	Proceed        bool                     `kong:"env='PROCEED',name='proceed',help='Proceed with renaming operations.'"`
+	Simulate       bool                     `kong:"env='SIMULATE',name='simulate',help='Simulate the proposed actions against an in-memory copy of the file system and write the simulated results. The case sensitivity of the file system is probed. Nothing is renamed, and execution is refused if any simulated action fails.'"`
+	Confirmation
+
+	Sources map[string]Source `kong:"-"` // The sources of values that weren't defaults
+}
+
+// source returns the source of the named value.
+func (conf Config) source(name string) Source {
+	if source, ok := conf.Sources[name]; ok {
+		return source
+	}
+	return DefaultSource
+}
+
+// Summary returns a multiline string describing the configuration, along
+// with the source of each value that may come from a configuration file.
+func (conf Config) Summary() string {
+	var output string
+	if conf.ConfigFile != "" {
+		output += fmt.Sprintf("Config File: %s (%s)\n", conf.ConfigFile, conf.source("config"))
+	}
+	output += fmt.Sprintf("Output File Name Prefix: %s (%s)", conf.FileNamePrefix, conf.source("name"))
+	if conf.OutputDir != "" {
+		output += fmt.Sprintf("\nOutput Directory: %s (%s)", conf.OutputDir, conf.source("output-dir"))
+	}
+	output += fmt.Sprintf("\nBase Path (Root): %s (%s)", conf.Root, conf.source("root"))
+	if conf.PatternsFile != "" {
+		output += fmt.Sprintf("\nPatterns File: %s (%s)", conf.PatternsFile, conf.source("patterns-file"))
+	} else if len(conf.Patterns) > 0 {
+		output += fmt.Sprintf("\nPatterns: %s", conf.source("pattern"))
+	}
+	for depth, pattern := range conf.Patterns {
+		if pattern.Comment != "" {
+			output += fmt.Sprintf("\nDepth %d Comment: %s", depth, pattern.Comment)
+		}
+		switch {
+		case pattern.Recursive:
+			output += fmt.Sprintf("\nDepth %d Pattern: **", depth)
+		case pattern.Expression == nil:
+			output += fmt.Sprintf("\nDepth %d Pattern: .*", depth)
+		default:
+			output += fmt.Sprintf("\nDepth %d Pattern: %s", depth, pattern.Expression)
+		}
+		if pattern.Subtitution != "" {
+			output += fmt.Sprintf("\nDepth %d Substitution: %s", depth, pattern.Subtitution)
+		}
+		if pattern.Expression != nil {
+			output += fmt.Sprintf("\nDepth %d Matching: %s", depth, pattern.EffectiveCase())
+		}
+		for _, rule := range pattern.Rules {
+			output += fmt.Sprintf("\nDepth %d Rule: %s", depth, rule)
+		}
+		if len(pattern.Rules) > 0 {
+			output += fmt.Sprintf("\nDepth %d Rules: %s", depth, pattern.Mode)
+		}
+		for _, exclusion := range conf.ExcludeAt {
+			if exclusion.Depth == depth {
+				output += fmt.Sprintf("\nDepth %d Exclude: %s", depth, exclusion.Exclusion)
+			}
+		}
+		for _, condition := range pattern.Conditions {
+			output += fmt.Sprintf("\nDepth %d Condition: %s", depth, condition)
+		}
+	}
+	for _, exclusion := range conf.Exclude {
+		output += fmt.Sprintf("\nExclude: %s", exclusion)
+	}
+	if conf.Map != "" {
+		output += fmt.Sprintf("\nMapping File: %s", conf.Map)
+		output += fmt.Sprintf("\nMapping Depth: %d", conf.MapDepth)
+		if conf.MapKey != "" {
+			output += fmt.Sprintf("\nMapping Key: %s", conf.MapKey)
+		}
+	}
+	switch {
+	case conf.Matched && conf.Unmatched:
+		output += fmt.Sprintf("\nShow: Both matching and non-matching files and directories")
+	case conf.Matched:
+		output += fmt.Sprintf("\nShow: Matching files and directories")
+	case conf.Unmatched:
+		output += fmt.Sprintf("\nShow: Non-matching files and directories")
+	}
+	if conf.Verbose {
+		output += fmt.Sprintf("\nVerbose Output")
+	}
+	output += fmt.Sprintf("\nConcurrency: %d (%s)", conf.Concurrency, conf.source("concurrency"))
+	if conf.CaseSensitive {
+		output += fmt.Sprintf("\nCase-Sensitive Matching (%s)", conf.source("case-sensitive"))
+	}
+	if conf.ProbeCase {
+		output += fmt.Sprintf("\nProbe File System Case Sensitivity (%s)", conf.source("probe-case"))
+	}
+	output += conf.Confirmation.Summary(conf.source)
+	if conf.Simulate {
+		output += fmt.Sprintf("\nSimulation Requested (%s)", conf.source("simulate"))
+	}
+	if conf.Proceed {
+		output += fmt.Sprintf("\nExecution Requested (%s)", conf.source("proceed"))
+	}
+	return output
+}
+
+// UndoConfig holds configuration values for the undo command, ingested from
+// the environment and command line.
+type UndoConfig struct {
+	FileNamePrefix string `kong:"env='NAME',name='name',default='migration',required,help='Output file name prefix.'"`
+	OutputDir      string `kong:"env='OUTPUT_DIR',name='output-dir',help='Directory in which output files are written.'"`
+	Results        string `kong:"env='RESULTS',name='results',arg,required,help='Results file produced by a previous run.'"`
+	Proceed        bool   `kong:"env='PROCEED',name='proceed',help='Proceed with undo operations.'"`
+	Confirmation
+}
+
+// Summary returns a multiline string describing the configuration.
+func (conf UndoConfig) Summary() string {
+	output := fmt.Sprintf("Output File Name Prefix: %s", conf.FileNamePrefix)
+	if conf.OutputDir != "" {
+		output += fmt.Sprintf("\nOutput Directory: %s", conf.OutputDir)
+	}
+	output += fmt.Sprintf("\nResults File: %s", conf.Results)
+	output += conf.Confirmation.Summary(nil)
+	if conf.Proceed {
+		output += fmt.Sprintf("\nExecution Requested")
+	}
+	return output
+}
+
+// ApplyConfig holds configuration values for the apply command, ingested
+// from the environment and command line.
+type ApplyConfig struct {
+	FileNamePrefix string `kong:"env='NAME',name='name',default='migration',required,help='Output file name prefix.'"`
+	OutputDir      string `kong:"env='OUTPUT_DIR',name='output-dir',help='Directory in which output files are written.'"`
+	Root           string `kong:"env='ROOT',name='root',required,help='Root path of the file directory structure.'"`
+	Plan           string `kong:"env='PLAN',name='plan',required,help='Proposed actions file, which may have been edited.'"`
+	Proceed        bool   `kong:"env='PROCEED',name='proceed',help='Proceed with renaming operations.'"`
+	Confirmation
+}
+
+// Summary returns a multiline string describing the configuration.
+func (conf ApplyConfig) Summary() string {
+	output := fmt.Sprintf("Output File Name Prefix: %s", conf.FileNamePrefix)
+	if conf.OutputDir != "" {
+		output += fmt.Sprintf("\nOutput Directory: %s", conf.OutputDir)
+	}
+	output += fmt.Sprintf("\nBase Path (Root): %s", conf.Root)
+	output += fmt.Sprintf("\nPlan File: %s", conf.Plan)
+	output += conf.Confirmation.Summary(nil)
+	if conf.Proceed {
+		output += fmt.Sprintf("\nExecution Requested")
+	}
+	return output
+}
+
+// ResumeConfig holds configuration values for the resume command, ingested
+// from the environment and command line.
+type ResumeConfig struct {
+	FileNamePrefix string `kong:"env='NAME',name='name',default='migration',required,help='Output file name prefix.'"`
+	OutputDir      string `kong:"env='OUTPUT_DIR',name='output-dir',help='Directory in which output files are written.'"`
+	Root           string `kong:"env='ROOT',name='root',required,help='Root path of the file directory structure.'"`
+	Plan           string `kong:"env='PLAN',name='plan',required,help='Proposed actions file of the interrupted run.'"`
+	Results        string `kong:"env='RESULTS',name='results',required,help='Results file of the interrupted run.'"`
+	Proceed        bool   `kong:"env='PROCEED',name='proceed',help='Proceed with renaming operations.'"`
+	Confirmation
+}
+
+// Summary returns a multiline string describing the configuration.
+func (conf ResumeConfig) Summary() string {
+	output := fmt.Sprintf("Output File Name Prefix: %s", conf.FileNamePrefix)
+	if conf.OutputDir != "" {
+		output += fmt.Sprintf("\nOutput Directory: %s", conf.OutputDir)
+	}
+	output += fmt.Sprintf("\nBase Path (Root): %s", conf.Root)
+	output += fmt.Sprintf("\nPlan File: %s", conf.Plan)
+	output += fmt.Sprintf("\nResults File: %s", conf.Results)
+	output += conf.Confirmation.Summary(nil)
+	if conf.Proceed {
+		output += fmt.Sprintf("\nExecution Requested")
+	}
+	return output
+}
+
+// Confirmation holds configuration values that determine how actions are
+// confirmed before they are carried out, so that unattended runs remain
+// safe.
+type Confirmation struct {
+	Yes           bool `kong:"env='YES',name='yes',help='Carry out actions without prompting for confirmation. Actions are only carried out when execution is requested.'"`
+	ExpectActions int  `kong:"env='EXPECT_ACTIONS',name='expect-actions',default='-1',help='Refuse to carry out actions unless exactly this many are proposed. Zero asserts that nothing will change. Negative values disable the check.'"`
+}
+
+// Summary returns a string describing the confirmation values that are in
+// effect, with each value on its own line. It returns an empty string if
+// they are all defaults. If source is non-nil, it is used to describe
+// where each value came from.
+func (conf Confirmation) Summary(source func(name string) Source) (output string) {
+	from := func(name string) string {
+		if source == nil {
+			return ""
+		}
+		return fmt.Sprintf(" (%s)", source(name))
+	}
+	if conf.ExpectActions >= 0 {
+		output += fmt.Sprintf("\nExpected Actions: %d%s", conf.ExpectActions, from("expect-actions"))
+	}
+	if conf.Yes {
+		output += fmt.Sprintf("\nConfirmation Not Required%s", from("yes"))
+	}
+	return output
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/alecthomas/kong"
+	"github.com/gentlemanautomaton/refret"
+)
+
+// Source identifies where a configuration value came from.
+type Source string
+
+// Configuration value sources
+const (
+	DefaultSource     Source = "default"
+	CommandLineSource Source = "command line"
+	EnvironmentSource Source = "environment"
+	ConfigFileSource  Source = "config file"
+)
+
+// ConfigFile describes the contents of a project-level configuration file
+// for the rename command. Values that are omitted from the file are left
+// unchanged.
+//
+// Relative paths in the file are relative to the directory that contains
+// it, so that the file can be checked into a repository alongside the files
+// it refers to and used from anywhere.
+type ConfigFile struct {
+	Name          *string               `json:"name"`
+	Root          *string               `json:"root"`
+	Patterns      []refret.PatternEntry `json:"patterns"`
+	PatternsFile  *string               `json:"patterns-file"`
+	Concurrency   *int                  `json:"concurrency"`
+	OutputDir     *string               `json:"output-dir"`
+	CaseSensitive *bool                 `json:"case-sensitive"`
+	ProbeCase     *bool                 `json:"probe-case"`
+	Simulate      *bool                 `json:"simulate"`
+	Proceed       *bool                 `json:"proceed"`
+	Yes           *bool                 `json:"yes"`
+	ExpectActions *int                  `json:"expect-actions"`
+}
+
+// LoadConfigFile reads a JSON configuration file and resolves the relative
+// paths within it. It also returns the SHA-256 hash of the file's contents.
+func LoadConfigFile(path string) (file ConfigFile, hash string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ConfigFile{}, "", err
+	}
+	sum := sha256.Sum256(data)
+	hash = hex.EncodeToString(sum[:])
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return ConfigFile{}, "", err
+	}
+
+	dir := filepath.Dir(path)
+	for _, p := range []*string{file.Root, file.PatternsFile, file.OutputDir} {
+		if p != nil && *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	return file, hash, nil
+}
+
+// Apply copies the values in file to conf, except for those that were
+// provided by flags or the environment, which take precedence. The source
+// of each value that is copied is recorded in conf.Sources.
+func (file ConfigFile) Apply(conf *Config) error {
+	if conf.Sources == nil {
+		conf.Sources = make(map[string]Source)
+	}
+	overridden := func(name string) bool {
+		switch conf.Sources[name] {
+		case CommandLineSource, EnvironmentSource:
+			return true
+		}
+		return false
+	}
+	set := func(name string) bool {
+		if overridden(name) {
+			return false
+		}
+		conf.Sources[name] = ConfigFileSource
+		return true
+	}
+
+	if file.Name != nil && set("name") {
+		conf.FileNamePrefix = *file.Name
+	}
+	if file.Root != nil && set("root") {
+		conf.Root = *file.Root
+	}
+	if file.Concurrency != nil && set("concurrency") {
+		conf.Concurrency = *file.Concurrency
+	}
+	if file.OutputDir != nil && set("output-dir") {
+		conf.OutputDir = *file.OutputDir
+	}
+	if file.CaseSensitive != nil && set("case-sensitive") {
+		conf.CaseSensitive = *file.CaseSensitive
+	}
+	if file.ProbeCase != nil && set("probe-case") {
+		conf.ProbeCase = *file.ProbeCase
+	}
+	if file.Simulate != nil && set("simulate") {
+		conf.Simulate = *file.Simulate
+	}
+	if file.Proceed != nil && set("proceed") {
+		conf.Proceed = *file.Proceed
+	}
+	if file.Yes != nil && set("yes") {
+		conf.Yes = *file.Yes
+	}
+	if file.ExpectActions != nil && set("expect-actions") {
+		conf.ExpectActions = *file.ExpectActions
+	}
+
+	// Patterns provided in any form on the command line replace those in
+	// the file
+	if overridden("pattern") || overridden("patterns-file") {
+		return nil
+	}
+	if file.PatternsFile != nil && set("patterns-file") {
+		conf.PatternsFile = *file.PatternsFile
+	}
+	if len(file.Patterns) > 0 && set("pattern") {
+		conf.Patterns = nil
+		for _, entry := range file.Patterns {
+			pattern, err := entry.Pattern()
+			if err != nil {
+				return err
+			}
+			conf.Patterns = append(conf.Patterns, pattern)
+		}
+	}
+	return nil
+}
+
+// valueSources returns the sources of the flags and arguments of the
+// selected command that were provided on the command line or by the
+// environment.
+func valueSources(ctx *kong.Context) map[string]Source {
+	sources := make(map[string]Source)
+	for _, flag := range ctx.Flags() {
+		if flag.Env != "" {
+			if _, ok := os.LookupEnv(flag.Env); ok {
+				sources[flag.Name] = EnvironmentSource
+			}
+		}
+	}
+	if node := ctx.Selected(); node != nil {
+		for _, arg := range node.Positional {
+			if arg.Tag.Env != "" {
+				if _, ok := os.LookupEnv(arg.Tag.Env); ok {
+					sources[arg.Name] = EnvironmentSource
+				}
+			}
+		}
+	}
+	for _, path := range ctx.Path {
+		switch {
+		case path.Flag != nil:
+			sources[path.Flag.Name] = CommandLineSource
+		case path.Positional != nil:
+			sources[path.Positional.Name] = CommandLineSource
+		}
+	}
+	return sources
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gentlemanautomaton/refret"
+)
+
+// execute prompts the user for confirmation and then performs actions
+// relative to root. Results are written progressively to a TSV file with
+// the given name.
+//
+// The kind of actions being performed is included in the prompt. The prompt
+// is skipped if confirm says so, and the actions are refused if their number
+// differs from the number that confirm expects. Any notes are written at the
+// top of the results file. If prior records are supplied, they are written
+// to the results file before any actions are performed, so that the file
+// describes the run as a whole.
+func execute(ctx context.Context, kind, resultsFileName, root string, confirm Confirmation, notes []string, prior []refret.Record, actions []refret.Action) {
+	actionsCount := pluralize(len(actions), "action", "actions")
+	itemsCount := pluralize(len(actions), "item", "items")
+
+	// Refuse to proceed if the number of actions isn't what was approved
+	if confirm.ExpectActions >= 0 && len(actions) != confirm.ExpectActions {
+		fmt.Printf("Refusing to proceed with %s when %d were expected.\n", actionsCount, confirm.ExpectActions)
+		os.Exit(1)
+	}
+
+	// Prompt the user for confirmation of the proposed actions
+	if confirm.Yes {
+		fmt.Printf("Proceeding with %s actions affecting %s without confirmation.\n", kind, itemsCount)
+	} else {
+		confirmed, err := prompt(fmt.Sprintf("Proceed with %s actions affecting %s?", kind, itemsCount))
+		if err != nil {
+			fmt.Printf("Cancelling due to unexpected response: %v\n", err)
+			os.Exit(1)
+		}
+
+		if !confirmed {
+			fmt.Printf("Cancelled.\n")
+			return
+		}
+	}
+
+	// Write results to a TSV file as we make progress
+	progress := make(chan refret.Record)
+	resultsFinished, err := refret.WriteRecordStream(resultsFileName, notes, progress)
+	if err != nil {
+		fmt.Printf("Failed to prepare output file %s: %v", resultsFileName, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Progressively writing results to %s.", resultsFileName)
+	for _, record := range prior {
+		progress <- record
+	}
+
+	// Perform the actions
+	fmt.Printf("Proceeding with the proposed %s, unto whatever end.\n", actionsCount)
+	processStart := time.Now()
+	results, processErr := refret.Process(ctx, root, actions,
+		refret.WithProgress(progress),
+		refret.BeforeAction(func(index int, record refret.Record) {
+			fmt.Printf("Performing action %d: %s\n", index, record.Action())
+		}),
+		refret.AfterAction(func(index int, record refret.Record) {
+			if record.Error != "" {
+				fmt.Printf("  FAILED: %s\n", record.Error)
+			}
+		}))
+	processEnd := time.Now()
+	processDuration := processEnd.Sub(processStart)
+
+	// Tell the TSV writer that we're done
+	close(progress)
+
+	// Wait for the TSV writer to finish
+	writeErr := <-resultsFinished
+
+	// Print a summary of the outcome
+	{
+		summary := Summarize(results)
+		if processErr != nil {
+			fmt.Printf("%s Stopped after %v due to error: %v\n", summary, processDuration, processErr)
+			os.Exit(1)
+		} else {
+			fmt.Printf("%s Done. (%v)\n", summary, processDuration)
+		}
+	}
+
+	// If we failed to write the results to a file, try dumping them to the screen
+	if writeErr != nil {
+		fmt.Printf("Failed to write results to file. Writing results to console as a last resort.\n")
+		showResults(ctx, results)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/alecthomas/kong"
+	"github.com/gentlemanautomaton/signaler"
+)
+
+func main() {
+	// Capture shutdown signals
+	shutdown := signaler.New().Capture(os.Interrupt, syscall.SIGTERM)
+	ctx := shutdown.Context()
+
+	// Parse configuration
+	var cli CLI
+
+	app := kong.Must(&cli,
+		kong.Description(description),
+		kong.UsageOnError())
+	parser, err := app.Parse(withDefaultCommand(app, "rename", os.Args[1:]))
+	app.FatalIfErrorf(err)
+
+	// Run the selected command
+	switch parser.Selected().Name {
+	case "rename":
+		cli.Rename.Sources = valueSources(parser)
+		rename(ctx, cli.Rename)
+	case "apply":
+		apply(ctx, cli.Apply)
+	case "resume":
+		resume(ctx, cli.Resume)
+	case "undo":
+		undo(ctx, cli.Undo)
+	}
+}
+
+// withDefaultCommand returns args with the name of the default command
+// inserted at the front when args don't begin with the name of a command,
+// so that invocations written before commands were introduced keep working.
+// Requests for help are left as-is.
+func withDefaultCommand(app *kong.Kong, command string, args []string) []string {
+	if len(args) > 0 {
+		switch args[0] {
+		case "-h", "--help":
+			return args
+		}
+		for _, node := range app.Model.Children {
+			if node.Name == args[0] {
+				return args
+			}
+		}
+	}
+	return append([]string{command}, args...)
+}
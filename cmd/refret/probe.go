@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gentlemanautomaton/refret"
+)
+
+// probePlanCase determines the case sensitivity of the file system at root
+// from the sources of a plan's actions, so that the plan can be validated
+// against it. If it can't be determined, the file system is assumed to be
+// case-sensitive.
+func probePlanCase(root string, actions []refret.Action) refret.CaseSensitivity {
+	fmt.Print("Probing file system case sensitivity...")
+	cs, determined, err := refret.ProbePlanCaseSensitivity(os.DirFS(root), actions)
+	switch {
+	case err != nil:
+		fmt.Printf(" failed: %v\n", err)
+		os.Exit(1)
+	case !determined:
+		fmt.Printf(" undetermined. Assuming %s.\n", strings.ToLower(cs.String()))
+	default:
+		fmt.Printf(" %s.\n", strings.ToLower(cs.String()))
+	}
+	return cs
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gentlemanautomaton/refret"
+)
+
+// rename scans the file system according to conf and proposes rename
+// actions. If requested, it carries them out.
+func rename(ctx context.Context, conf Config) {
+	// Load the configuration file if one was provided, and note its hash in
+	// each of the output files
+	var notes []string
+	if conf.ConfigFile != "" {
+		fmt.Printf("Reading configuration from %s...", conf.ConfigFile)
+		file, hash, err := LoadConfigFile(conf.ConfigFile)
+		if err == nil {
+			err = file.Apply(&conf)
+		}
+		if err != nil {
+			fmt.Printf(" failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf(" done. (SHA-256 %s)\n", hash)
+		notes = append(notes, fmt.Sprintf("Config File: %s (SHA-256 %s)", conf.ConfigFile, hash))
+	}
+	if conf.Root == "" {
+		fmt.Printf("No root path was provided.\n")
+		os.Exit(1)
+	}
+
+	// Load patterns from a file if one was provided, and note its hash in
+	// each of the output files
+	if conf.PatternsFile != "" {
+		if len(conf.Patterns) > 0 {
+			fmt.Printf("Patterns can't be provided both as arguments and in a patterns file.\n")
+			os.Exit(1)
+		}
+		fmt.Printf("Reading patterns from %s...", conf.PatternsFile)
+		patterns, hash, err := refret.LoadPatterns(conf.PatternsFile)
+		if err != nil {
+			fmt.Printf(" failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf(" done. (SHA-256 %s)\n", hash)
+		conf.Patterns = patterns
+		notes = append(notes, fmt.Sprintf("Patterns File: %s (SHA-256 %s)", conf.PatternsFile, hash))
+	}
+
+	// Make sure that patterns reach the depth of the mapping table, if one
+	// was provided
+	if conf.Map != "" {
+		if conf.MapDepth < 0 {
+			fmt.Printf("The mapping depth must not be negative.\n")
+			os.Exit(1)
+		}
+		for len(conf.Patterns) <= conf.MapDepth {
+			conf.Patterns = append(conf.Patterns, refret.Pattern{})
+		}
+		if len(conf.Patterns[conf.MapDepth].Counters()) > 0 {
+			fmt.Printf("A mapping can't be applied at depth %d, which has a pattern with counters.\n", conf.MapDepth)
+			os.Exit(1)
+		}
+	}
+
+	// Attach alternative rules to the patterns at their depths
+	for _, rule := range conf.Rules {
+		if rule.Depth >= len(conf.Patterns) {
+			fmt.Printf("A rule was provided for depth %d, which has no pattern.\n", rule.Depth)
+			os.Exit(1)
+		}
+		if conf.Patterns[rule.Depth].Recursive {
+			fmt.Printf("A rule was provided for depth %d, which has a recursive pattern.\n", rule.Depth)
+			os.Exit(1)
+		}
+		conf.Patterns[rule.Depth].Rules = append(conf.Patterns[rule.Depth].Rules, rule.Rule)
+	}
+	for _, depth := range conf.Chain {
+		if depth < 0 || depth >= len(conf.Patterns) {
+			fmt.Printf("Chaining was requested for depth %d, which has no pattern.\n", depth)
+			os.Exit(1)
+		}
+		conf.Patterns[depth].Mode = refret.Chain
+	}
+	for depth, pattern := range conf.Patterns {
+		if len(pattern.Rules) > 0 && pattern.Expression == nil && pattern.Mode != refret.Chain {
+			fmt.Printf("Rules were provided for depth %d, which has a pattern that matches everything, so they would never be tried.\n", depth)
+			os.Exit(1)
+		}
+	}
+
+	// Attach exclusions to the patterns at their depths, and global
+	// exclusions to every pattern
+	for _, exclusion := range conf.ExcludeAt {
+		if exclusion.Depth >= len(conf.Patterns) {
+			fmt.Printf("An exclusion was provided for depth %d, which has no pattern.\n", exclusion.Depth)
+			os.Exit(1)
+		}
+		conf.Patterns[exclusion.Depth].Exclusions = append(conf.Patterns[exclusion.Depth].Exclusions, exclusion.Exclusion)
+	}
+	for i := range conf.Patterns {
+		conf.Patterns[i].Exclusions = append(conf.Patterns[i].Exclusions, conf.Exclude...)
+	}
+
+	// Apply the global case mode to patterns that don't specify their own
+	if conf.CaseSensitive {
+		for i := range conf.Patterns {
+			if err := conf.Patterns[i].SetDefaultCase(refret.MatchCase); err != nil {
+				fmt.Printf("Failed to prepare pattern: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		for i := range conf.Exclude {
+			if err := conf.Exclude[i].SetDefaultCase(refret.MatchCase); err != nil {
+				fmt.Printf("Failed to prepare exclusion: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		for i := range conf.ExcludeAt {
+			if err := conf.ExcludeAt[i].Exclusion.SetDefaultCase(refret.MatchCase); err != nil {
+				fmt.Printf("Failed to prepare exclusion: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	// Attach metadata conditions to the patterns at their depths
+	for _, where := range conf.Where {
+		if where.Depth >= len(conf.Patterns) {
+			fmt.Printf("Conditions were provided for depth %d, which has no pattern.\n", where.Depth)
+			os.Exit(1)
+		}
+		conf.Patterns[where.Depth].Conditions = append(conf.Patterns[where.Depth].Conditions, where.Conditions...)
+	}
+
+	// Read the mapping table if one was provided, and apply it on top of
+	// the patterns
+	renamer := refret.Renamer(refret.Patterns(conf.Patterns))
+	var mapping *refret.Mapping
+	if conf.Map != "" {
+		var options []refret.MappingOption
+		if conf.CaseSensitive {
+			options = append(options, refret.WithMappingCase(refret.MatchCase))
+		}
+		if conf.MapKey != "" {
+			key := conf.MapKey
+			if !conf.CaseSensitive {
+				key = "(?i)" + key
+			}
+			expression, err := regexp.Compile(key)
+			if err != nil {
+				fmt.Printf("Failed to prepare mapping key: %v\n", err)
+				os.Exit(1)
+			}
+			options = append(options, refret.WithKeyExpression(expression))
+		}
+		fmt.Printf("Reading mapping from %s...", conf.Map)
+		rows, err := refret.ReadMapping(conf.Map)
+		if err == nil {
+			mapping, err = refret.NewMapping(rows, options...)
+		}
+		if err != nil {
+			fmt.Printf(" failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf(" done. (%s)\n", pluralize(len(rows), "row", "rows"))
+		renamer = mapping.Renamer(renamer, conf.MapDepth)
+	}
+
+	fmt.Println(conf.Summary())
+
+	// Scan the file system
+	fmt.Print("Scanning directories and files...\n")
+	//scanner := refret.NewScanner(os.DirFS(conf.Root), renamer, refret.WithCallback(makeShowFileCallback(conf.Matched, conf.Unmatched, conf.Verbose)), refret.WithConcurrency(conf.Concurrency))
+	fsys := os.DirFS(conf.Root)
+	scanner := refret.NewScanner(fsys, renamer, refret.WithConcurrency(conf.Concurrency))
+	scanStart := time.Now()
+	files, err := scanner.Scan(ctx)
+	scanEnd := time.Now()
+	scanDuration := scanEnd.Sub(scanStart)
+	if err != nil {
+		if err == context.Canceled {
+			fmt.Printf("Scanning directories and files... stopped. (%v)\n", scanDuration)
+			fmt.Printf("Operation cancelled.\n")
+		} else {
+			fmt.Printf("Scanning directories and files... failed: %v\n", err)
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("Scanning directories and files... done. (%v)\n", scanDuration)
+
+	// Probe the case sensitivity of the file system if requested, or if the
+	// actions will be simulated, because the simulation depends on it
+	cs := refret.CaseSensitive
+	if conf.ProbeCase || conf.Simulate {
+		fmt.Print("Probing file system case sensitivity...")
+		probed, determined, err := refret.ProbeCaseSensitivity(fsys, files)
+		switch {
+		case err != nil:
+			fmt.Printf(" failed: %v\n", err)
+			os.Exit(1)
+		case !determined:
+			fmt.Printf(" undetermined. Assuming %s.\n", strings.ToLower(cs.String()))
+		default:
+			cs = probed
+			fmt.Printf(" %s.\n", strings.ToLower(cs.String()))
+		}
+	}
+
+	// Show the file scan results if requested
+	if conf.Matched || conf.Unmatched {
+		if err := showFiles(ctx, conf.Matched, conf.Unmatched, conf.Verbose, files); err != nil {
+			if err == context.Canceled {
+				fmt.Printf("Operation cancelled.\n")
+			} else {
+				fmt.Printf("Failed to display results: %v\n", err)
+			}
+			os.Exit(1)
+		}
+	}
+
+	// Build the set of proposed file rename actions, and the set of actions
+	// that were omitted from it
+	actions := refret.BuildActions(files, cs)
+	omitted := refret.BuildOmitted(files)
+
+	// Write the omitted files to a TSV file
+	omittedFileName := filepath.Join(conf.OutputDir, fmt.Sprintf("%s-omitted %s.tsv", conf.FileNamePrefix, currentTimestamp()))
+	fmt.Printf("Writing omitted actions to %s...", omittedFileName)
+	err = refret.WriteOmitted(omittedFileName, notes, omitted)
+	if err != nil {
+		fmt.Printf(" failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(" done.\n")
+
+	// Write the unused rows of the mapping table to a TSV file
+	if mapping != nil {
+		if unused := mapping.Unused(); len(unused) > 0 {
+			unusedFileName := filepath.Join(conf.OutputDir, fmt.Sprintf("%s-unused %s.tsv", conf.FileNamePrefix, currentTimestamp()))
+			fmt.Printf("Writing unused mapping rows to %s...", unusedFileName)
+			err = refret.WriteMappingRows(unusedFileName, notes, unused)
+			if err != nil {
+				fmt.Printf(" failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(" done.\n")
+			fmt.Printf("%s unused.\n", pluralize(len(unused), "mapping row", "mapping rows"))
+		}
+	}
+
+	if len(actions) == 0 {
+		fmt.Printf("No actions proposed.\n")
+		return
+	}
+
+	// Write the proposed actions to a TSV file
+	proposedFileName := filepath.Join(conf.OutputDir, fmt.Sprintf("%s-proposed %s.tsv", conf.FileNamePrefix, currentTimestamp()))
+	fmt.Printf("Writing proposed actions to %s...", proposedFileName)
+	err = refret.WriteActions(proposedFileName, notes, actions)
+	if err != nil {
+		fmt.Printf(" failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(" done.\n")
+
+	// Print a summary of the proposed actions
+	actionsCount := pluralize(len(actions), "action", "actions")
+	fmt.Printf("%s proposed.\n", actionsCount)
+
+	// Look for proposed actions that would collide with other files
+	collisions, err := refret.BuildCollisions(fsys, files, cs)
+	if err != nil {
+		fmt.Printf("Failed to look for collisions: %v\n", err)
+		os.Exit(1)
+	}
+	if len(collisions) > 0 {
+		collisionsFileName := filepath.Join(conf.OutputDir, fmt.Sprintf("%s-collisions %s.tsv", conf.FileNamePrefix, currentTimestamp()))
+		fmt.Printf("Writing collisions to %s...", collisionsFileName)
+		err = refret.WriteCollisions(collisionsFileName, notes, collisions)
+		if err != nil {
+			fmt.Printf(" failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(" done.\n")
+		fmt.Printf("%s detected.\n", pluralize(len(collisions), "collision", "collisions"))
+	}
+
+	// Simulate the actions against an in-memory copy of the scanned files if
+	// requested, and write the results that the real run would produce
+	if conf.Simulate {
+		fmt.Print("Simulating proposed actions...")
+		simulateStart := time.Now()
+		simulated, err := refret.Simulate(ctx, fsys, conf.Root, files, cs, actions)
+		simulateDuration := time.Since(simulateStart)
+		if err != nil {
+			if err == context.Canceled {
+				fmt.Printf(" stopped. (%v)\n", simulateDuration)
+				fmt.Printf("Operation cancelled.\n")
+			} else {
+				fmt.Printf(" failed: %v\n", err)
+			}
+			os.Exit(1)
+		}
+		fmt.Printf(" done. (%v)\n", simulateDuration)
+
+		simulatedFileName := filepath.Join(conf.OutputDir, fmt.Sprintf("%s-simulated %s.tsv", conf.FileNamePrefix, currentTimestamp()))
+		fmt.Printf("Writing simulated results to %s...", simulatedFileName)
+		err = refret.WriteRecords(simulatedFileName, notes, simulated)
+		if err != nil {
+			fmt.Printf(" failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(" done.\n")
+
+		summary := Summarize(simulated)
+		fmt.Printf("Simulation: %s\n", summary)
+
+		// Refuse to proceed with actions that are known to fail
+		if conf.Proceed && summary.MoveFailure > 0 {
+			fmt.Printf("Refusing to proceed until simulated failures are resolved.\n")
+			os.Exit(1)
+		}
+	}
+
+	// If the user hasn't opted-in to renaming things, stop now
+	if !conf.Proceed {
+		return
+	}
+
+	// Refuse to proceed while collisions remain unresolved
+	if len(collisions) > 0 {
+		fmt.Printf("Refusing to proceed until collisions are resolved.\n")
+		os.Exit(1)
+	}
+
+	// Perform the actions
+	resultsFileName := filepath.Join(conf.OutputDir, fmt.Sprintf("%s-results %s.tsv", conf.FileNamePrefix, currentTimestamp()))
+	execute(ctx, "rename", resultsFileName, conf.Root, conf.Confirmation, notes, nil, actions)
+}
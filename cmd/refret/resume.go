@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gentlemanautomaton/refret"
+)
+
+// resume reads a plan of proposed actions and the results of an interrupted
+// run of that plan, then validates the actions that have not yet succeeded
+// and, if requested, carries them out.
+func resume(ctx context.Context, conf ResumeConfig) {
+	fmt.Println(conf.Summary())
+
+	// Read the plan
+	fmt.Printf("Reading plan from %s...", conf.Plan)
+	actions, err := refret.ReadActions(conf.Plan)
+	if err != nil {
+		fmt.Printf(" failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(" done.\n")
+
+	// Read the results of the interrupted run
+	fmt.Printf("Reading results from %s...", conf.Results)
+	records, err := refret.ReadRecords(conf.Results)
+	if err != nil {
+		fmt.Printf(" failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf(" done. (%s)\n", pluralize(len(records), "record", "records"))
+
+	// Determine which actions have already succeeded
+	completed, prior := refret.CompletedActions(conf.Root, actions, records)
+	remaining := len(actions) - len(prior)
+	fmt.Printf("%d of %s already completed.\n", len(prior), pluralize(len(actions), "action", "actions"))
+	if remaining == 0 {
+		fmt.Printf("No actions remaining.\n")
+		return
+	}
+
+	// Make sure every remaining action in the plan is valid
+	cs := probePlanCase(conf.Root, actions)
+	fmt.Printf("Validating remaining actions...")
+	problems, err := refret.ValidatePlan(conf.Root, cs, actions, completed)
+	if err != nil {
+		fmt.Printf(" failed: %v\n", err)
+		os.Exit(1)
+	}
+	if len(problems) > 0 {
+		fmt.Printf(" failed: %s found.\n", pluralize(len(problems), "problem", "problems"))
+		for _, problem := range problems {
+			fmt.Printf("  %s\n", problem)
+		}
+		os.Exit(1)
+	}
+	fmt.Print(" done.\n")
+
+	// Print a summary of the remaining actions
+	fmt.Printf("%s remaining.\n", pluralize(remaining, "action", "actions"))
+
+	// If the user hasn't opted-in to renaming things, stop now
+	if !conf.Proceed {
+		return
+	}
+
+	// Perform the remaining actions. The records of the actions that have
+	// already succeeded are carried over to the new results file, so that it
+	// can be used to undo the entire run.
+	var pending []refret.Action
+	for i, action := range actions {
+		if !completed[i] {
+			pending = append(pending, action)
+		}
+	}
+	resultsFileName := filepath.Join(conf.OutputDir, fmt.Sprintf("%s-results %s.tsv", conf.FileNamePrefix, currentTimestamp()))
+	execute(ctx, "rename", resultsFileName, conf.Root, conf.Confirmation, nil, prior, pending)
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"strings"
+
+	"github.com/gentlemanautomaton/refret"
 )
 
 // showFiles prints the results of a file scan.
-func showFiles(ctx context.Context, matched, unmatched, verbose bool, files []File) error {
+func showFiles(ctx context.Context, matched, unmatched, verbose bool, files []refret.File) error {
 	for _, file := range files {
 		if err := ctx.Err(); err != nil {
 			return err
@@ -28,8 +30,8 @@ func showFiles(ctx context.Context, matched, unmatched, verbose bool, files []Fi
 	return nil
 }
 
-func makeShowFileCallback(matched, unmatched, verbose bool) ScanCallback {
-	return func(file File) {
+func makeShowFileCallback(matched, unmatched, verbose bool) refret.ScanCallback {
+	return func(file refret.File) {
 		if shouldInclude(file, matched, unmatched) {
 			if verbose {
 				fmt.Printf("%s %s\n", strings.Repeat("  ", file.Depth), file.VerboseString())
@@ -40,9 +42,9 @@ func makeShowFileCallback(matched, unmatched, verbose bool) ScanCallback {
 	}
 }
 
-func shouldInclude(file File, matched, unmatched bool) bool {
+func shouldInclude(file refret.File, matched, unmatched bool) bool {
 	if matched {
-		if file.Result == Matched {
+		if file.Result == refret.Matched {
 			return true
 		}
 		if file.DescendantsMatched > 0 {
@@ -50,7 +52,7 @@ func shouldInclude(file File, matched, unmatched bool) bool {
 		}
 	}
 	if unmatched {
-		if file.Result == NotMatched {
+		if file.Result == refret.NotMatched {
 			return true
 		}
 		if file.DescendantsNotMatched > 0 {
@@ -60,7 +62,7 @@ func shouldInclude(file File, matched, unmatched bool) bool {
 	return false
 }
 
-func showResults(ctx context.Context, results []Record) error {
+func showResults(ctx context.Context, results []refret.Record) error {
 	for i, record := range results {
 		if err := ctx.Err(); err != nil {
 			return err
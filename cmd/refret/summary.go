@@ -1,6 +1,10 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/gentlemanautomaton/refret"
+)
 
 // Summary holds summarized data for a set of records.
 type Summary struct {
@@ -28,7 +32,7 @@ func (s Summary) String() string {
 }
 
 // Summarize returns a summary for a set of records.
-func Summarize(records []Record) Summary {
+func Summarize(records []refret.Record) Summary {
 	var s Summary
 	for _, record := range records {
 		s.MoveAttempted++
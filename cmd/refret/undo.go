@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gentlemanautomaton/refret"
+)
+
+// undo reads the results of a previous run and proposes actions that
+// reverse them. If requested, it carries them out.
+func undo(ctx context.Context, conf UndoConfig) {
+	fmt.Println(conf.Summary())
+
+	// Read the results of the previous run
+	fmt.Printf("Reading results from %s...", conf.Results)
+	records, err := refret.ReadRecords(conf.Results)
+	if err != nil {
+		fmt.Printf(" failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf(" done. (%s)\n", pluralize(len(records), "record", "records"))
+
+	// Build the set of proposed undo actions
+	actions := refret.BuildUndoActions(records)
+	if len(actions) == 0 {
+		fmt.Printf("No actions proposed.\n")
+		return
+	}
+
+	// Write the proposed actions to a TSV file
+	proposedFileName := filepath.Join(conf.OutputDir, fmt.Sprintf("%s-undo-proposed %s.tsv", conf.FileNamePrefix, currentTimestamp()))
+	fmt.Printf("Writing proposed actions to %s...", proposedFileName)
+	err = refret.WriteActions(proposedFileName, nil, actions)
+	if err != nil {
+		fmt.Printf(" failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(" done.\n")
+
+	// Print a summary of the proposed actions
+	fmt.Printf("%s proposed.\n", pluralize(len(actions), "action", "actions"))
+
+	// If the user hasn't opted-in to undoing things, stop now
+	if !conf.Proceed {
+		return
+	}
+
+	// Perform the actions. The paths in the results file already include
+	// the root of the original run, so no root is supplied here.
+	resultsFileName := filepath.Join(conf.OutputDir, fmt.Sprintf("%s-undo-results %s.tsv", conf.FileNamePrefix, currentTimestamp()))
+	execute(ctx, "undo", resultsFileName, "", conf.Confirmation, nil, nil, actions)
+}
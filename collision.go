@@ -0,0 +1,202 @@
+package refret
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Collision reasons
+const (
+	DuplicateTarget = "duplicate target"
+	ExistingTarget  = "target exists"
+	InvalidTarget   = "invalid target"
+	ParentConflict  = "target parent conflict"
+)
+
+// Collision describes a proposed action with a target that conflicts with
+// another file in the same directory.
+type Collision struct {
+	OldPath string
+	NewPath string
+	Reason  string
+}
+
+// String returns a string representation of the collision.
+func (c Collision) String() string {
+	return c.OldPath + " → " + c.NewPath + ": " + c.Reason
+}
+
+// BuildCollisions analyzes a set of files that have been scanned and returns
+// the proposed actions that would collide with one another or with existing
+// files.
+//
+// Files are compared with their siblings. A collision is reported when two
+// or more siblings would be renamed to the same name, or when a sibling would
+// be renamed to the name of a sibling that is not being renamed.
+//
+// When a new name moves a file into a subdirectory, a collision is also
+// reported if the new name is not a valid relative path, or if one of its
+// parent directories would conflict with a file or with another action. If
+// the subdirectory already exists, the new name is looked up within it, as
+// it will be once the actions within it have been performed. Directories
+// that weren't traversed by the scan are looked up in fsys, which holds the
+// scanned files.
+//
+// Names are compared according to the case sensitivity of the file system.
+func BuildCollisions(fsys fs.FS, files []File, cs CaseSensitivity) (collisions []Collision, err error) {
+	collisions, err = findCollisions(fsys, files, cs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		nested, err := BuildCollisions(fsys, files[i].Contents, cs)
+		if err != nil {
+			return nil, err
+		}
+		collisions = append(collisions, nested...)
+	}
+	return collisions, nil
+}
+
+// findCollisions returns the collisions among a set of sibling files.
+func findCollisions(fsys fs.FS, siblings []File, cs CaseSensitivity) (collisions []Collision, err error) {
+	untouched := make(map[string]File)
+	sources := make(map[string]bool)
+	targets := make(map[string]int)
+	for _, file := range siblings {
+		if file.Actionable() {
+			sources[cs.Key(file.Name)] = true
+			targets[cs.Key(file.NewName)]++
+		} else {
+			untouched[cs.Key(file.Name)] = file
+		}
+	}
+
+	// parentConflict returns true if a parent directory of name can't be
+	// used or created
+	parentConflict := func(name string) bool {
+		first := cs.Key(name[:strings.IndexByte(name, '/')])
+		if existing, ok := untouched[first]; ok && !existing.IsDir {
+			return true
+		}
+		if sources[first] {
+			return true
+		}
+		for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+			if targets[cs.Key(parent)] > 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, file := range siblings {
+		if !file.Actionable() {
+			continue
+		}
+		collision := Collision{
+			OldPath: path.Join(file.Parent, file.Name),
+			NewPath: path.Join(file.Parent, file.NewName),
+		}
+		_, exists := untouched[cs.Key(file.NewName)]
+		switch {
+		case validatePath(file.NewName) != nil:
+			collision.Reason = InvalidTarget
+		case exists:
+			collision.Reason = ExistingTarget
+		case targets[cs.Key(file.NewName)] > 1:
+			collision.Reason = DuplicateTarget
+		case strings.Contains(file.NewName, "/") && parentConflict(file.NewName):
+			collision.Reason = ParentConflict
+		default:
+			// Look for the target within an existing subdirectory
+			first, rest := splitFirst(file.NewName)
+			dir, ok := untouched[cs.Key(first)]
+			if rest == "" || !ok {
+				continue
+			}
+			if collision.Reason, err = nestedConflict(fsys, dir, rest, cs); err != nil {
+				return nil, err
+			}
+			if collision.Reason == "" {
+				continue
+			}
+		}
+		collisions = append(collisions, collision)
+	}
+
+	return collisions, nil
+}
+
+// nestedConflict returns the reason that the slash-separated path p within
+// the directory dir can't be used as a target, or an empty string if it
+// can. Any actions within dir are assumed to have been performed.
+//
+// The contents of directories that weren't traversed by the scan are looked
+// up in fsys.
+func nestedConflict(fsys fs.FS, dir File, p string, cs CaseSensitivity) (reason string, err error) {
+	for {
+		if dir.Contents == nil {
+			return unscannedConflict(fsys, path.Join(dir.Parent, dir.Name), p)
+		}
+		first, rest := splitFirst(p)
+		occupant := findOccupant(dir.Contents, first, cs)
+		switch {
+		case occupant == nil:
+			return "", nil
+		case rest == "":
+			return ExistingTarget, nil
+		case !occupant.IsDir:
+			return ParentConflict, nil
+		}
+		dir, p = *occupant, rest
+	}
+}
+
+// unscannedConflict returns the reason that the slash-separated path p
+// within the directory dir in fsys can't be used as a target, or an empty
+// string if it can.
+func unscannedConflict(fsys fs.FS, dir, p string) (reason string, err error) {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		dir = path.Join(dir, part)
+		info, err := fs.Stat(fsys, dir)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return "", nil
+		case err != nil:
+			return "", err
+		case i == len(parts)-1:
+			return ExistingTarget, nil
+		case !info.IsDir():
+			return ParentConflict, nil
+		}
+	}
+	return "", nil
+}
+
+// findOccupant returns the file among siblings that will have the given
+// name once they have been renamed, or nil if there is none.
+func findOccupant(siblings []File, name string, cs CaseSensitivity) *File {
+	for i := range siblings {
+		current := siblings[i].Name
+		if siblings[i].Actionable() {
+			current = siblings[i].NewName
+		}
+		if cs.Key(current) == cs.Key(name) {
+			return &siblings[i]
+		}
+	}
+	return nil
+}
+
+// splitFirst splits the slash-separated path p into its first element and
+// the rest of the path.
+func splitFirst(p string) (first, rest string) {
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
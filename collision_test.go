@@ -0,0 +1,114 @@
+package refret
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// collisionReasons scans fsys with renamer and returns the reason for each
+// collision, keyed by the old path of its action.
+func collisionReasons(t *testing.T, fsys fstest.MapFS, renamer Renamer) map[string]string {
+	t.Helper()
+	files, err := NewScanner(fsys, renamer).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	collisions, err := BuildCollisions(fsys, files, CaseSensitive)
+	if err != nil {
+		t.Fatalf("failed to build collisions: %v", err)
+	}
+	reasons := make(map[string]string)
+	for _, collision := range collisions {
+		reasons[collision.OldPath] = collision.Reason
+	}
+	return reasons
+}
+
+func TestBuildCollisionsSiblings(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a":    data(1),
+		"b":    data(1),
+		"c":    data(1),
+		"d":    data(1),
+		"kept": data(1),
+		"file": data(1),
+	}
+	renamer := mapRenamer{
+		"a":    "same",
+		"b":    "same",
+		"c":    "kept",
+		"d":    "../escape",
+		"file": "file/nested",
+	}
+	want := map[string]string{
+		"a":    DuplicateTarget,
+		"b":    DuplicateTarget,
+		"c":    ExistingTarget,
+		"d":    InvalidTarget,
+		"file": ParentConflict,
+	}
+	if got := collisionReasons(t, fsys, renamer); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected collisions: got %v, want %v", got, want)
+	}
+}
+
+func TestBuildCollisionsNested(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Acme - 2019/report": data(1),
+		"Acme - 2020/report": data(1),
+		"Acme - 2021/report": data(1),
+		"Acme - 2022/report": data(1),
+		"Acme/2018/report":   data(1),
+		"Acme/2020/report":   data(1),
+		"Acme/2021/report":   data(1),
+		"Acme/notes":         data(1),
+	}
+
+	// Acme/2021 is moved out of the way within Acme, and Acme/2019 is
+	// taken by a rename within Acme
+	renamer := mapRenamer{
+		"Acme - 2019": "Acme/2019",
+		"Acme - 2020": "Acme/2020",
+		"Acme - 2021": "Acme/2021",
+		"Acme - 2022": "Acme/2018/report/2022",
+		"Acme/2021":   "2021-old",
+		"Acme/notes":  "2019",
+	}
+	want := map[string]string{
+		"Acme - 2019": ExistingTarget,
+		"Acme - 2020": ExistingTarget,
+		"Acme - 2022": ParentConflict,
+	}
+	if got := collisionReasons(t, fsys, renamer); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected collisions when scanned: got %v, want %v", got, want)
+	}
+}
+
+func TestBuildCollisionsUnscanned(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Acme - 2020/report": data(1),
+		"Acme - 2021/report": data(1),
+		"Acme - 2022/report": data(1),
+		"Acme - 2023/report": data(1),
+		"Acme/2020/report":   data(1),
+		"Acme/notes":         data(1),
+	}
+
+	// Acme isn't traversed, so its contents are looked up in fsys
+	renamer := shallowRenamer{
+		"Acme - 2020": "Acme/2020",
+		"Acme - 2021": "Acme/2021",
+		"Acme - 2022": "Acme/notes/2022",
+		"Acme - 2023": "Acme/notes",
+	}
+	want := map[string]string{
+		"Acme - 2020": ExistingTarget,
+		"Acme - 2022": ParentConflict,
+		"Acme - 2023": ExistingTarget,
+	}
+	if got := collisionReasons(t, fsys, renamer); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected collisions when unscanned: got %v, want %v", got, want)
+	}
+}
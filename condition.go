@@ -0,0 +1,222 @@
+package refret
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Condition is a test applied to the metadata of a file.
+type Condition struct {
+	Field    string // type, size, mtime or perm
+	Operator string // =, <, >, <=, >=, & or !&
+	Value    string // The value as written
+
+	types []string
+	size  int64
+	time  time.Time
+	perm  fs.FileMode
+}
+
+// operators is the set of condition operators, longest first.
+var operators = []string{"<=", ">=", "!&", "<", ">", "=", "&"}
+
+// timeLayouts is the set of layouts accepted by mtime conditions.
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// ParseConditions parses a comma-separated list of conditions. Each
+// condition is a field, an operator and a value, such as mtime<2020-01-01.
+// The following conditions are supported:
+//
+//	type=file|dir|symlink  The file is one of the given types
+//	size<N                 The size compared to N bytes, with an optional
+//	                       K, M, G or T suffix (=, <, >, <= or >=)
+//	mtime<T                The modification time compared to T, as a local
+//	                       date, date and time, or RFC 3339 time
+//	                       (<, >, <= or >=)
+//	perm=NNNN              The permission bits are exactly NNNN (octal)
+//	perm&NNNN              All of the permission bits in NNNN are set
+//	perm!&NNNN             None of the permission bits in NNNN are set
+func ParseConditions(s string) (conditions []Condition, err error) {
+	for _, text := range strings.Split(s, ",") {
+		condition, err := parseCondition(strings.TrimSpace(text))
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
+
+func parseCondition(text string) (c Condition, err error) {
+	index := strings.IndexAny(text, "<>=&!")
+	if index < 0 {
+		return Condition{}, fmt.Errorf("condition \"%s\" is missing an operator", text)
+	}
+	c.Field = text[:index]
+	for _, op := range operators {
+		if strings.HasPrefix(text[index:], op) {
+			c.Operator = op
+			break
+		}
+	}
+	if c.Operator == "" {
+		return Condition{}, fmt.Errorf("condition \"%s\" has an invalid operator", text)
+	}
+	c.Value = text[index+len(c.Operator):]
+	if c.Value == "" {
+		return Condition{}, fmt.Errorf("condition \"%s\" is missing a value", text)
+	}
+
+	allowed := ""
+	switch c.Field {
+	case "type":
+		allowed = "="
+		for _, t := range strings.Split(c.Value, "|") {
+			switch t {
+			case "file", "dir", "symlink":
+				c.types = append(c.types, t)
+			default:
+				err = fmt.Errorf("unknown type \"%s\"", t)
+			}
+		}
+	case "size":
+		allowed = "= < > <= >="
+		c.size, err = parseSize(c.Value)
+	case "mtime":
+		allowed = "< > <= >="
+		c.time, err = parseTime(c.Value)
+	case "perm":
+		allowed = "= & !&"
+		var perm uint64
+		perm, err = strconv.ParseUint(c.Value, 8, 32)
+		c.perm = fs.FileMode(perm)
+		if err == nil && c.perm&^fs.ModePerm != 0 {
+			err = errors.New("permission bits out of range")
+		}
+	default:
+		return Condition{}, fmt.Errorf("condition \"%s\" has an unknown field \"%s\"", text, c.Field)
+	}
+	if err != nil {
+		return Condition{}, fmt.Errorf("condition \"%s\" has an invalid value: %v", text, err)
+	}
+	if !strings.Contains(" "+allowed+" ", " "+c.Operator+" ") {
+		return Condition{}, fmt.Errorf("condition \"%s\" has an operator that can't be used with %s", text, c.Field)
+	}
+	return c, nil
+}
+
+// String returns a string representation of the condition.
+func (c Condition) String() string {
+	return c.Field + c.Operator + c.Value
+}
+
+// Test returns true if the file described by vars satisfies the condition.
+func (c Condition) Test(vars Vars) bool {
+	switch c.Field {
+	case "type":
+		for _, t := range c.types {
+			switch {
+			case t == "file" && vars.Mode.IsRegular():
+				return true
+			case t == "dir" && vars.Mode.IsDir():
+				return true
+			case t == "symlink" && vars.Mode&fs.ModeSymlink != 0:
+				return true
+			}
+		}
+		return false
+	case "size":
+		return compare(c.Operator, vars.Size, c.size)
+	case "mtime":
+		return compare(c.Operator, vars.ModTime.UnixNano(), c.time.UnixNano())
+	case "perm":
+		perm := vars.Mode.Perm()
+		switch c.Operator {
+		case "=":
+			return perm == c.perm
+		case "&":
+			return perm&c.perm == c.perm
+		case "!&":
+			return perm&c.perm == 0
+		}
+	}
+	return false
+}
+
+// DepthConditions is a set of conditions that apply to files at a
+// particular depth.
+type DepthConditions struct {
+	Depth      int
+	Conditions []Condition
+}
+
+// UnmarshalText unmarshals the given text as a depth, followed by a colon
+// and a comma-separated list of conditions.
+func (dc *DepthConditions) UnmarshalText(text []byte) error {
+	pair := strings.SplitN(string(text), ":", 2)
+	if len(pair) != 2 {
+		return fmt.Errorf("conditions \"%s\" must be prefixed with a depth and a colon", text)
+	}
+	depth, err := strconv.Atoi(pair[0])
+	if err != nil || depth < 0 {
+		return fmt.Errorf("conditions \"%s\" have an invalid depth \"%s\"", text, pair[0])
+	}
+	conditions, err := ParseConditions(pair[1])
+	if err != nil {
+		return err
+	}
+	dc.Depth = depth
+	dc.Conditions = conditions
+	return nil
+}
+
+func compare(op string, a, b int64) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "<":
+		return a < b
+	case ">":
+		return a > b
+	case "<=":
+		return a <= b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+func parseSize(s string) (int64, error) {
+	multiplier := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	case "T":
+		multiplier = 1 << 40
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return size * multiplier, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time \"%s\"", s)
+}
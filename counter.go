@@ -0,0 +1,173 @@
+package refret
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// CounterScope determines which files share a counter's sequence.
+type CounterScope string
+
+// Counter scopes
+const (
+	ParentScope CounterScope = "parent" // Files within the same directory
+	DepthScope  CounterScope = "depth"  // Files at the same depth
+	GlobalScope CounterScope = "global" // All files
+)
+
+// CounterOrder determines the order in which a counter numbers files.
+type CounterOrder string
+
+// Counter orders
+const (
+	IndexOrder CounterOrder = "index" // The order in which files were listed
+	NameOrder  CounterOrder = "name"  // Case-insensitive name order
+)
+
+// Counter identifies a sequence of files that is numbered by counter
+// placeholders.
+type Counter struct {
+	Scope CounterScope
+	Order CounterOrder
+}
+
+func parseCounterScope(s string) (CounterScope, error) {
+	switch scope := CounterScope(s); scope {
+	case ParentScope, DepthScope, GlobalScope:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("unknown scope \"%s\"", s)
+	}
+}
+
+func parseCounterOrder(s string) (CounterOrder, error) {
+	switch order := CounterOrder(s); order {
+	case IndexOrder, NameOrder:
+		return order, nil
+	default:
+		return "", fmt.Errorf("unknown order \"%s\"", s)
+	}
+}
+
+// NumberFiles assigns sequence numbers to files that have been scanned and
+// matched by patterns with counter placeholders, then applies those patterns
+// again to determine the final names of the files.
+//
+// Files are numbered in depth-first order, with each set of siblings sorted
+// according to the counter's order. Only matched files are numbered, and
+// only for the counters used by the rules that were applied to them. The
+// new parent paths and descendant counts of every file are updated to
+// reflect the final names.
+func NumberFiles(files []File, patterns []Pattern) {
+	// Determine which counters are used by the patterns
+	var counters []Counter
+	seen := make(map[Counter]bool)
+	for _, pattern := range patterns {
+		for _, counter := range pattern.Counters() {
+			if !seen[counter] {
+				seen[counter] = true
+				counters = append(counters, counter)
+			}
+		}
+	}
+	if len(counters) == 0 {
+		return
+	}
+
+	// Determine which pattern matched each file, and which counters are
+	// used by the rules that were applied to it
+	matched := make(map[*File]int)
+	used := make(map[*File]map[Counter]bool)
+	matchPatterns(files, patterns, StartPositions(patterns), matched, used)
+
+	// Number the files for each counter
+	sequences := make(map[*File]map[Counter]int)
+	for _, counter := range counters {
+		next := make(map[int]int) // Maps depths to the next number
+		numberFiles(files, counter, used, matched, sequences, next)
+	}
+
+	// Apply the patterns again with the sequence numbers
+	renumberFiles(files, patterns, matched, sequences, "")
+}
+
+// matchPatterns records the position of the pattern that matched each file
+// in matched, following the same positions that were followed during the
+// scan. The counters used by the rules that were applied to each file are
+// recorded in used.
+func matchPatterns(files []File, patterns []Pattern, positions []int, matched map[*File]int, used map[*File]map[Counter]bool) {
+	for i := range files {
+		file := &files[i]
+		_, _, pattern, applied, next := applyPatterns(patterns, positions, file.Vars())
+		if pattern >= 0 {
+			matched[file] = pattern
+			for _, counter := range patterns[pattern].appliedCounters(applied) {
+				if used[file] == nil {
+					used[file] = make(map[Counter]bool)
+				}
+				used[file][counter] = true
+			}
+		}
+		matchPatterns(file.Contents, patterns, next, matched, used)
+	}
+}
+
+func numberFiles(files []File, counter Counter, used map[*File]map[Counter]bool, matched map[*File]int, sequences map[*File]map[Counter]int, next map[int]int) {
+	if len(files) == 0 {
+		return
+	}
+
+	// Sort the files
+	sorted := make([]*File, len(files))
+	for i := range files {
+		sorted[i] = &files[i]
+	}
+	if counter.Order == NameOrder {
+		sort.SliceStable(sorted, func(i, j int) bool {
+			a, b := strings.ToLower(sorted[i].Name), strings.ToLower(sorted[j].Name)
+			if a == b {
+				return sorted[i].Name < sorted[j].Name
+			}
+			return a < b
+		})
+	}
+
+	// Each directory starts a new sequence in the parent scope
+	depth := files[0].Depth
+	key := depth
+	switch counter.Scope {
+	case ParentScope:
+		next[depth] = 0
+	case GlobalScope:
+		key = -1
+	}
+
+	for _, file := range sorted {
+		if _, ok := matched[file]; ok && file.Result == Matched && used[file][counter] {
+			if sequences[file] == nil {
+				sequences[file] = make(map[Counter]int)
+			}
+			sequences[file][counter] = next[key]
+			next[key]++
+		}
+		numberFiles(file.Contents, counter, used, matched, sequences, next)
+	}
+}
+
+func renumberFiles(files []File, patterns []Pattern, matched map[*File]int, sequences map[*File]map[Counter]int, newParent string) {
+	for i := range files {
+		file := &files[i]
+		file.NewParent = newParent
+		if seq, ok := sequences[file]; ok {
+			vars := file.Vars()
+			vars.Sequences = seq
+			_, file.NewName, _ = patterns[matched[file]].Apply(vars)
+		}
+		renumberFiles(file.Contents, patterns, matched, sequences, path.Join(file.NewParent, file.NewName))
+		file.DescendantsMatched = countDescendantsMatched(file.Contents)
+		file.DescendantsNotMatched = countDescendantsNotMatched(file.Contents)
+		file.DescendantActions = countDescendantActions(file.Contents)
+	}
+}
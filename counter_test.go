@@ -0,0 +1,84 @@
+package refret
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// mustPattern returns the pattern parsed from text, with the given rules.
+func mustPattern(t *testing.T, text string, rules ...string) Pattern {
+	t.Helper()
+	var p Pattern
+	if err := p.UnmarshalText([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range rules {
+		var rule Pattern
+		if err := rule.UnmarshalText([]byte(text)); err != nil {
+			t.Fatal(err)
+		}
+		p.Rules = append(p.Rules, rule)
+	}
+	return p
+}
+
+// newNames scans fsys with patterns and returns the new name of each file
+// at the root, keyed by its name.
+func newNames(t *testing.T, fsys fstest.MapFS, patterns Patterns) map[string]string {
+	t.Helper()
+	files, err := NewScanner(fsys, patterns).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	names := make(map[string]string)
+	for _, file := range files {
+		names[file.Name] = file.NewName
+	}
+	return names
+}
+
+func TestNumberFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"b": data(1),
+		"a": data(1),
+		"c": data(1),
+	}
+	patterns := Patterns{mustPattern(t, `^(.*)$/{n}-$1`)}
+	want := map[string]string{"a": "1-a", "b": "2-b", "c": "3-c"}
+	if got := newNames(t, fsys, patterns); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected names: got %v, want %v", got, want)
+	}
+}
+
+func TestNumberFilesWithRules(t *testing.T) {
+	fsys := fstest.MapFS{
+		"IMG_a": data(1),
+		"DSC_b": data(1),
+		"IMG_c": data(1),
+		"DSC_d": data(1),
+	}
+
+	// Files matched by a rule without a counter don't take a number
+	patterns := Patterns{mustPattern(t, `^IMG_(.*)/{n}-$1`, `^DSC_(.*)/dsc-$1`)}
+	want := map[string]string{"IMG_a": "1-a", "DSC_b": "dsc-b", "IMG_c": "2-c", "DSC_d": "dsc-d"}
+	if got := newNames(t, fsys, patterns); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected names with a counter in the pattern: got %v, want %v", got, want)
+	}
+
+	// Nor do files matched by the pattern when only a rule has a counter
+	patterns = Patterns{mustPattern(t, `^IMG_(.*)/img-$1`, `^DSC_(.*)/{n}-$1`)}
+	want = map[string]string{"IMG_a": "img-a", "DSC_b": "1-b", "IMG_c": "img-c", "DSC_d": "2-d"}
+	if got := newNames(t, fsys, patterns); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected names with a counter in a rule: got %v, want %v", got, want)
+	}
+
+	// Chained rules share the counters of every rule that was applied
+	chained := mustPattern(t, `^IMG_(.*)/img-$1`, `^(.*)-a$/{n}-$1`)
+	chained.Mode = Chain
+	want = map[string]string{"IMG_a": "1-img", "DSC_b": "DSC_b", "IMG_c": "img-c", "DSC_d": "DSC_d"}
+	if got := newNames(t, fsys, Patterns{chained}); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected names with chained rules: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,18 @@
+// Package refret searches for and renames files according to regular
+// expression patterns.
+//
+// A Scanner traverses a file system and applies a Pattern at each depth to
+// the names of the files it finds. The scanned files can then be planned
+// into a set of actions with BuildActions, checked for collisions with
+// BuildCollisions and ValidatePlan, and carried out with Process, which
+// returns a Record of each action taken. Process acts on the local file
+// system by default, or on any other FileSystem such as a
+// MemoryFileSystem. Simulate performs actions against an in-memory copy of
+// the scanned files, so that a plan can be checked without modifying
+// anything.
+//
+// Plans and records can be written to and read from tab-separated files
+// with WriteActions, ReadActions, WriteRecordStream and ReadRecords.
+//
+// The refret command in cmd/refret provides a command line interface.
+package refret
@@ -0,0 +1,76 @@
+package refret
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Exclusion is a regular expression that prevents the files it matches from
+// being matched by a pattern.
+type Exclusion struct {
+	Expression *regexp.Regexp
+	source     string // The expression as written
+}
+
+// UnmarshalText unmarshals the given text as an exclusion in e. Like
+// patterns, exclusions match case-insensitively by default.
+func (e *Exclusion) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		return fmt.Errorf("exclusion must not be empty")
+	}
+	*e = Exclusion{source: string(text)}
+	return e.SetDefaultCase(DefaultCase)
+}
+
+// SetDefaultCase sets the case mode used by e. The default mode is
+// IgnoreCase.
+func (e *Exclusion) SetDefaultCase(mode CaseMode) error {
+	exp, err := compileRegex(e.source, mode != MatchCase)
+	if err != nil {
+		return err
+	}
+	e.Expression = exp
+	return nil
+}
+
+// Excludes returns true if e matches name.
+func (e Exclusion) Excludes(name string) bool {
+	return e.Expression != nil && e.Expression.MatchString(name)
+}
+
+// String returns a string representation of the exclusion.
+func (e Exclusion) String() string {
+	if e.Expression == nil {
+		return e.source
+	}
+	return e.Expression.String()
+}
+
+// DepthExclusion is an exclusion that applies to the pattern at a
+// particular depth.
+type DepthExclusion struct {
+	Depth     int
+	Exclusion Exclusion
+}
+
+// UnmarshalText unmarshals the given text as a depth, followed by a colon
+// and an exclusion.
+func (de *DepthExclusion) UnmarshalText(text []byte) error {
+	pair := strings.SplitN(string(text), ":", 2)
+	if len(pair) != 2 {
+		return fmt.Errorf("exclusion \"%s\" must be prefixed with a depth and a colon", text)
+	}
+	depth, err := strconv.Atoi(pair[0])
+	if err != nil || depth < 0 {
+		return fmt.Errorf("exclusion \"%s\" has an invalid depth \"%s\"", text, pair[0])
+	}
+	var exclusion Exclusion
+	if err := exclusion.UnmarshalText([]byte(pair[1])); err != nil {
+		return err
+	}
+	de.Depth = depth
+	de.Exclusion = exclusion
+	return nil
+}
@@ -1,9 +1,11 @@
-package main
+package refret
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"strconv"
+	"time"
 )
 
 // File represents a file within the target file system
@@ -15,26 +17,71 @@ type File struct {
 	Parent                string
 	NewParent             string
 	IsDir                 bool
+	Mode                  fs.FileMode // Only the type bits, unless the renamer needs metadata
+	Size                  int64       // Only set if the renamer needs metadata
+	ModTime               time.Time   // Only set if the renamer needs metadata
 	Result                Match
+	Rule                  string // The rules that produced the new name
+	Reason                string // The reason the file was not matched
 	DescendantsMatched    int
 	DescendantsNotMatched int
 	DescendantActions     int
 	Contents              []File
+
+	contents Renamer // The renamer for the contents of a directory
 }
 
-// NewFile returns a file with it static properties set.
-func NewFile(patterns []Pattern, depth int, index int, entry fs.DirEntry, oldParent, newParent string) File {
-	name := entry.Name()
-	result, newName := ApplyPattern(patterns, depth, name)
-	return File{
+// NewFile returns a file with it static properties set. The renamer is
+// applied to it to determine its new name.
+//
+// Patterns with counter placeholders are applied without sequence numbers.
+// The final names of files matched by them are determined by NumberFiles.
+//
+// The file's metadata is only retrieved if the renamer needs it. If the file
+// no longer exists by then, it is not matched. It returns an error if the
+// metadata can't be retrieved for any other reason.
+func NewFile(renamer Renamer, depth int, index int, entry fs.DirEntry, oldParent, newParent string) (File, error) {
+	file := File{
 		Depth:     depth,
 		Index:     index,
-		Name:      name,
-		NewName:   newName,
-		Result:    result,
+		Name:      entry.Name(),
 		Parent:    oldParent,
 		NewParent: newParent,
 		IsDir:     entry.IsDir(),
+		Mode:      entry.Type(),
+	}
+	if needsMetadata(renamer) {
+		info, err := entry.Info()
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			file.Result = NotMatched
+			file.NewName = file.Name
+			file.Reason = VanishedReason
+			return file, nil
+		case err != nil:
+			return File{}, err
+		}
+		file.Mode = info.Mode()
+		file.Size = info.Size()
+		file.ModTime = info.ModTime()
+	}
+	outcome := renamer.Rename(file)
+	file.Result = outcome.Result
+	file.NewName = outcome.NewName
+	file.Rule = outcome.Rule
+	file.Reason = outcome.Reason
+	file.contents = outcome.Contents
+	return file, nil
+}
+
+// Vars returns the values of f that are available to placeholders in
+// substitutions and to conditions.
+func (f File) Vars() Vars {
+	return Vars{
+		Name:    f.Name,
+		Mode:    f.Mode,
+		Size:    f.Size,
+		ModTime: f.ModTime,
 	}
 }
 
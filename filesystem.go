@@ -0,0 +1,59 @@
+package refret
+
+import (
+	"io/fs"
+	"os"
+)
+
+// FileSystem is a writable file system on which actions can be performed.
+//
+// Paths are in the form used by the local file system, as produced by
+// joining the root of a plan with its relative paths.
+type FileSystem interface {
+	// Rename moves oldpath to newpath.
+	Rename(oldpath, newpath string) error
+
+	// Mkdir creates a directory with the given permissions.
+	Mkdir(name string, perm fs.FileMode) error
+
+	// Stat returns information about the named file. If it is a symbolic
+	// link, information about the link itself is returned.
+	Stat(name string) (fs.FileInfo, error)
+
+	// Remove removes a file or an empty directory.
+	Remove(name string) error
+}
+
+// OSFileSystem is a FileSystem that performs actions on the local file
+// system. It is the file system used by Process by default.
+type OSFileSystem struct{}
+
+// Rename moves oldpath to newpath by calling os.Rename.
+func (OSFileSystem) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// Mkdir creates a directory by calling os.Mkdir.
+func (OSFileSystem) Mkdir(name string, perm fs.FileMode) error {
+	return os.Mkdir(name, perm)
+}
+
+// Stat returns information about the named file by calling os.Lstat.
+func (OSFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+// Remove removes a file or an empty directory by calling os.Remove.
+func (OSFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// sameFile returns true if a and b describe the same file. It understands
+// file information returned by both OSFileSystem and MemoryFileSystem.
+func sameFile(a, b fs.FileInfo) bool {
+	if x, ok := a.(memoryFileInfo); ok {
+		y, ok := b.(memoryFileInfo)
+		return ok && x.node == y.node
+	}
+	return os.SameFile(a, b)
+}
@@ -0,0 +1,208 @@
+package refret
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestSameFileOS(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var fsys OSFileSystem
+	a1, err := fsys.Stat(filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, err := fsys.Stat(filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fsys.Stat(filepath.Join(dir, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sameFile(a1, a2) {
+		t.Errorf("two lookups of the same file are not the same file")
+	}
+	if sameFile(a1, b) {
+		t.Errorf("different files are the same file")
+	}
+}
+
+func TestSameFileMemory(t *testing.T) {
+	m := NewMemoryFileSystem(CaseInsensitive)
+	for _, name := range []string{"a", "b"} {
+		if err := m.Add(name, 0644, 0, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a1, err := m.Stat("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, err := m.Stat("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.Stat("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sameFile(a1, a2) {
+		t.Errorf("two lookups of the same file are not the same file")
+	}
+	if sameFile(a1, b) {
+		t.Errorf("different files are the same file")
+	}
+
+	// A file keeps its identity when it is renamed
+	if err := m.Rename("a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	c, err := m.Stat("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameFile(a1, c) {
+		t.Errorf("a renamed file is not the same file")
+	}
+}
+
+func TestSameFileMixed(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a")
+	if err := os.WriteFile(name, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	osInfo, err := OSFileSystem{}.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMemoryFileSystem(CaseSensitive)
+	if err := m.Add(name, 0644, 0, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	memInfo, err := m.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sameFile(osInfo, memInfo) || sameFile(memInfo, osInfo) {
+		t.Errorf("files from different file systems are the same file")
+	}
+}
+
+func TestMemoryFileSystemRename(t *testing.T) {
+	m := NewMemoryFileSystem(CaseSensitive)
+	for _, name := range []string{"dir/a", "dir/b"} {
+		if err := m.Add(name, 0644, 0, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Rename("dir/a", "dir/b"); err == nil {
+		t.Errorf("renamed a file over the top of another one")
+	}
+	if err := m.Rename("dir", "dir/sub"); err == nil {
+		t.Errorf("moved a directory into itself")
+	}
+	if err := m.Rename("dir/a", "missing/a"); err == nil {
+		t.Errorf("moved a file into a missing directory")
+	}
+	if err := m.Rename("dir", "moved"); err != nil {
+		t.Fatalf("failed to rename a directory: %v", err)
+	}
+	if _, err := m.Stat("moved/a"); err != nil {
+		t.Errorf("contents of a renamed directory were lost: %v", err)
+	}
+	if _, err := m.Stat("dir/a"); !os.IsNotExist(err) {
+		t.Errorf("contents of a renamed directory remain at the old path: %v", err)
+	}
+}
+
+func TestMemoryFileSystemRemove(t *testing.T) {
+	m := NewMemoryFileSystem(CaseSensitive)
+	if err := m.Add("dir/a", 0644, 0, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Mkdir("empty", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Remove("dir"); err == nil {
+		t.Errorf("removed a directory that isn't empty")
+	}
+	if err := m.Remove("empty"); err != nil {
+		t.Errorf("failed to remove an empty directory: %v", err)
+	}
+	if _, err := m.Stat("empty"); !os.IsNotExist(err) {
+		t.Errorf("removed directory still exists: %v", err)
+	}
+	if fi, err := m.Stat("dir"); err != nil || fi.Mode()&fs.ModeDir == 0 {
+		t.Errorf("parent added implicitly is not a directory: %v", err)
+	}
+}
+
+func TestMemoryFileSystemMount(t *testing.T) {
+	base := fstest.MapFS{
+		"dir/a":        &fstest.MapFile{},
+		"dir/sub/b":    &fstest.MapFile{},
+		"other/c":      &fstest.MapFile{},
+		"replaced/old": &fstest.MapFile{},
+	}
+	m := NewMemoryFileSystem(CaseSensitive)
+	if err := m.Mount("root", base); err != nil {
+		t.Fatal(err)
+	}
+
+	// Contents are read from the mounted file system when needed
+	if fi, err := m.Stat("root/dir/sub/b"); err != nil || fi.IsDir() {
+		t.Errorf("failed to read a file from the mounted file system: %v", err)
+	}
+
+	// A moved directory keeps its contents, even if they haven't been read
+	if err := m.Rename("root/other", "root/dir/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Stat("root/dir/moved/c"); err != nil {
+		t.Errorf("contents of a moved directory were lost: %v", err)
+	}
+	if _, err := m.Stat("root/other/c"); !os.IsNotExist(err) {
+		t.Errorf("contents of a moved directory remain at the old path: %v", err)
+	}
+
+	// A directory that replaces a moved one doesn't inherit its contents
+	if err := m.Rename("root/replaced", "root/gone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add("root/replaced", fs.ModeDir|0755, 0, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Remove("root/replaced"); err != nil {
+		t.Errorf("failed to remove a new directory: %v", err)
+	}
+
+	// Directories that aren't empty in the mounted file system can't be
+	// removed
+	if err := m.Remove("root/gone"); err == nil {
+		t.Errorf("removed a directory that isn't empty in the mounted file system")
+	}
+
+	// Nothing that is created conflicts with files that haven't been read
+	if err := m.Mkdir("root/dir/sub/b", 0755); err == nil {
+		t.Errorf("created a directory over a file in the mounted file system")
+	}
+}
@@ -0,0 +1,90 @@
+package refret
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// globPrefix marks a pattern whose expression is written as a glob.
+const globPrefix = "glob:"
+
+// globToRegex translates a glob expression into a regular expression that
+// matches entire names.
+//
+// An asterisk matches any sequence of characters, and a question mark
+// matches any single character. Brackets match any one of the characters
+// within them, which may include ranges such as [0-9] and may be negated
+// with a leading ! or ^. Braces match any one of the comma-separated
+// alternatives within them, such as {jpg,jpeg}, which may contain further
+// glob syntax. A backslash matches the character that follows it literally.
+//
+// Each asterisk, question mark and bracket expression becomes a capture
+// group, so that substitutions can refer to the text it matched as $1, $2
+// and so on, counting them from left to right. Braces don't capture, so they
+// don't affect the numbering of the wildcards around them.
+//
+// If the glob is invalid, it returns the rune index of the problem.
+func globToRegex(glob string) (re string, index int, err error) {
+	runes := []rune(glob)
+	var b strings.Builder
+	var braces []int // The indices of the open braces
+	b.WriteString("^")
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\':
+			if i+1 >= len(runes) {
+				return "", i, errors.New("incomplete escape sequence in glob")
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case r == '*':
+			b.WriteString("(.*)")
+		case r == '?':
+			b.WriteString("(.)")
+		case r == '[':
+			end := i + 1
+			if end < len(runes) && (runes[end] == '!' || runes[end] == '^') {
+				end++
+			}
+			if end < len(runes) && runes[end] == ']' {
+				end++
+			}
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end >= len(runes) {
+				return "", i, errors.New("unterminated character class in glob")
+			}
+			class := runes[i+1 : end]
+			b.WriteString("([")
+			if class[0] == '!' || class[0] == '^' {
+				b.WriteString("^")
+				class = class[1:]
+			}
+			for _, c := range class {
+				if c == '\\' || c == '[' {
+					b.WriteRune('\\')
+				}
+				b.WriteRune(c)
+			}
+			b.WriteString("])")
+			i = end
+		case r == '{':
+			braces = append(braces, i)
+			b.WriteString("(?:")
+		case r == ',' && len(braces) > 0:
+			b.WriteString("|")
+		case r == '}' && len(braces) > 0:
+			braces = braces[:len(braces)-1]
+			b.WriteString(")")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if len(braces) > 0 {
+		return "", braces[len(braces)-1], errors.New("unterminated brace in glob")
+	}
+	b.WriteString("$")
+	return b.String(), 0, nil
+}
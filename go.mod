@@ -3,9 +3,11 @@ module github.com/gentlemanautomaton/refret
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/alecthomas/kong v0.2.15
 	github.com/gentlemanautomaton/signaler v0.0.0-20180126105343-ab8bba8a505a
 	github.com/gocarina/gocsv v0.0.0-20201208093247-67c824bc04d4
 	github.com/pkg/errors v0.9.1 // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,174 @@
+package refret
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// UnmappedReason is the reason given for files that were not matched
+// because a mapping has no entry for them.
+const UnmappedReason = "not in mapping"
+
+// MappingRow is a single row of a mapping table, which maps an old name or
+// key to a new one.
+type MappingRow struct {
+	Old string
+	New string
+}
+
+// MappingOption is an option for NewMapping.
+type MappingOption func(*Mapping)
+
+// WithKeyExpression returns an option that looks up names in a mapping by
+// the key that expression extracts from them, rather than by the whole
+// name. The key is the first capture group of the expression, or its whole
+// match if it has no capture groups. Only the key is replaced within a name.
+func WithKeyExpression(expression *regexp.Regexp) MappingOption {
+	return func(m *Mapping) {
+		m.key = expression
+	}
+}
+
+// WithMappingCase returns an option that determines whether keys are
+// compared case-sensitively. The default mode is IgnoreCase.
+func WithMappingCase(mode CaseMode) MappingOption {
+	return func(m *Mapping) {
+		m.sensitive = mode == MatchCase
+	}
+}
+
+// Mapping is a lookup table of new names. It keeps track of the rows that
+// have been used, so that unused rows can be reported.
+//
+// It is safe for concurrent use.
+type Mapping struct {
+	rows      []MappingRow
+	index     map[string]int
+	key       *regexp.Regexp
+	sensitive bool
+
+	mutex sync.Mutex
+	used  []bool
+}
+
+// NewMapping returns a mapping for the given rows. It returns an error if
+// any of the rows are empty or have the same key.
+func NewMapping(rows []MappingRow, options ...MappingOption) (*Mapping, error) {
+	m := &Mapping{
+		rows:  rows,
+		index: make(map[string]int, len(rows)),
+		used:  make([]bool, len(rows)),
+	}
+	for _, option := range options {
+		option(m)
+	}
+	for i, row := range rows {
+		if row.Old == "" || row.New == "" {
+			return nil, fmt.Errorf("mapping row %d is incomplete", i+2)
+		}
+		key := m.fold(row.Old)
+		if other, exists := m.index[key]; exists {
+			return nil, fmt.Errorf("mapping rows %d and %d have the same key \"%s\"", other+2, i+2, row.Old)
+		}
+		m.index[key] = i
+	}
+	return m, nil
+}
+
+// fold returns the form of key that is used for comparisons.
+func (m *Mapping) fold(key string) string {
+	if m.sensitive {
+		return key
+	}
+	return strings.ToLower(key)
+}
+
+// Lookup returns the new name for name, along with the row that provided
+// it. It returns false if the mapping has no entry for name.
+func (m *Mapping) Lookup(name string) (newName string, row MappingRow, ok bool) {
+	start, end := 0, len(name)
+	if m.key != nil {
+		match := m.key.FindStringSubmatchIndex(name)
+		switch {
+		case match == nil:
+			return name, MappingRow{}, false
+		case len(match) >= 4 && match[2] >= 0:
+			start, end = match[2], match[3]
+		default:
+			start, end = match[0], match[1]
+		}
+	}
+
+	i, ok := m.index[m.fold(name[start:end])]
+	if !ok {
+		return name, MappingRow{}, false
+	}
+	m.mutex.Lock()
+	m.used[i] = true
+	m.mutex.Unlock()
+	return name[:start] + m.rows[i].New + name[end:], m.rows[i], true
+}
+
+// Unused returns the rows of the mapping that haven't been used by Lookup.
+func (m *Mapping) Unused() (rows []MappingRow) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, row := range m.rows {
+		if !m.used[i] {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// Renamer returns a renamer that applies the mapping to the names of files
+// at depth that are matched by base. The mapping is applied to the new
+// names produced by base. Files at depth that have no entry in the mapping
+// are not matched.
+func (m *Mapping) Renamer(base Renamer, depth int) Renamer {
+	return mappingRenamer{mapping: m, base: base, depth: depth}
+}
+
+// mappingRenamer applies a mapping at a particular depth.
+type mappingRenamer struct {
+	mapping *Mapping
+	base    Renamer
+	depth   int
+}
+
+// Rename applies the base renamer to file, then applies the mapping if file
+// is at the mapping's depth.
+func (r mappingRenamer) Rename(file File) Outcome {
+	outcome := r.base.Rename(file)
+	if outcome.Contents != nil {
+		outcome.Contents = mappingRenamer{mapping: r.mapping, base: outcome.Contents, depth: r.depth}
+	}
+	if file.Depth != r.depth || outcome.Result != Matched {
+		return outcome
+	}
+	newName, row, ok := r.mapping.Lookup(outcome.NewName)
+	if !ok {
+		return Outcome{Result: NotMatched, NewName: file.Name, Reason: UnmappedReason}
+	}
+	outcome.NewName = newName
+	if outcome.Rule != "" {
+		outcome.Rule += " + "
+	}
+	outcome.Rule += "map " + row.Old + " → " + row.New
+	return outcome
+}
+
+// NeedsMetadata returns true if the base renamer needs the metadata of
+// files. The mapping itself only uses names.
+func (r mappingRenamer) NeedsMetadata() bool {
+	return needsMetadata(r.base)
+}
+
+// Finish lets the base renamer finish its work, if it needs to.
+func (r mappingRenamer) Finish(files []File) {
+	if finisher, ok := r.base.(Finisher); ok {
+		finisher.Finish(files)
+	}
+}
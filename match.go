@@ -1,4 +1,4 @@
-package main
+package refret
 
 // Match describes the result of a potential pattern match
 type Match int
@@ -0,0 +1,380 @@
+package refret
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory file system errors
+var (
+	errNotDirectory      = errors.New("not a directory")
+	errDirectoryNotEmpty = errors.New("directory not empty")
+)
+
+// MemoryFileSystem is a FileSystem that is held in memory. It can be
+// populated with Add and used in place of the local file system, so that
+// actions can be performed and verified without modifying anything on disk.
+//
+// Another file system can be mounted with Mount, in which case the contents
+// of its directories are read when they are first needed. Changes are never
+// written back to it.
+//
+// Unlike the local file system, it refuses to rename a file over the top of
+// another one.
+//
+// It is safe for concurrent use.
+type MemoryFileSystem struct {
+	cs    CaseSensitivity
+	mutex sync.Mutex
+	root  *memoryNode
+}
+
+// NewMemoryFileSystem returns an empty memory file system that compares
+// names according to cs.
+func NewMemoryFileSystem(cs CaseSensitivity) *MemoryFileSystem {
+	return &MemoryFileSystem{
+		cs:   cs,
+		root: newMemoryNode("", fs.ModeDir|0755, nil, ""),
+	}
+}
+
+// Mount makes the contents of base available beneath name, which is added as
+// a directory if it is missing. The contents of each directory are read from
+// base when they are first needed, so only the parts of base that are used
+// are read. Files that have already been added beneath name take precedence
+// over those in base.
+//
+// Files read from base have no metadata other than their names and types.
+func (m *MemoryFileSystem) Mount(name string, base fs.FS) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	node, err := m.mkdirAll(splitMemoryPath(name), false)
+	if err != nil {
+		return &fs.PathError{Op: "mount", Path: name, Err: err}
+	}
+	node.base, node.origin, node.loaded = base, ".", false
+	return nil
+}
+
+// Add adds a file with the given metadata to the file system, creating any
+// parent directories that are missing. If mode describes a directory, a
+// directory is added.
+//
+// Adding a directory that already exists updates its metadata, so that
+// directories can be added after their contents.
+func (m *MemoryFileSystem) Add(name string, mode fs.FileMode, size int64, modTime time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.add(splitMemoryPath(name), mode, size, modTime, true); err != nil {
+		return &fs.PathError{Op: "add", Path: name, Err: err}
+	}
+	return nil
+}
+
+// add adds a file at the path made up of parts. If load is true, the
+// contents of its parent directories are loaded first, and any directories
+// that are created are new, so they have nothing to load. Otherwise the
+// file is assumed to exist in the mounted file system, if there is one.
+func (m *MemoryFileSystem) add(parts []string, mode fs.FileMode, size int64, modTime time.Time, load bool) error {
+	if len(parts) == 0 {
+		return fs.ErrExist
+	}
+	parent, err := m.mkdirAll(parts[:len(parts)-1], load)
+	if err != nil {
+		return err
+	}
+	if load {
+		if err := m.load(parent); err != nil {
+			return err
+		}
+	}
+
+	base := parts[len(parts)-1]
+	if existing, ok := parent.children[m.cs.Key(base)]; ok {
+		if !existing.IsDir() || !mode.IsDir() {
+			return fs.ErrExist
+		}
+		existing.mode, existing.size, existing.modTime = mode, size, modTime
+		return nil
+	}
+	node := parent.newChild(base, mode)
+	node.size, node.modTime, node.loaded = size, modTime, load
+	parent.attach(m.cs, node)
+	return nil
+}
+
+// mkdirAll returns the directory at the path made up of parts, creating it
+// and any of its parents that are missing. If load is true, the contents of
+// each directory are loaded before its children are looked up, and the
+// directories that are created have nothing to load.
+func (m *MemoryFileSystem) mkdirAll(parts []string, load bool) (*memoryNode, error) {
+	node := m.root
+	for _, part := range parts {
+		if load {
+			if err := m.load(node); err != nil {
+				return nil, err
+			}
+		}
+		child, ok := node.children[m.cs.Key(part)]
+		switch {
+		case !ok:
+			child = node.newChild(part, fs.ModeDir|0755)
+			child.loaded = load
+			node.attach(m.cs, child)
+		case !child.IsDir():
+			return nil, errNotDirectory
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// Rename moves oldpath to newpath. The parent of newpath must already
+// exist. Nothing may exist at newpath, unless it is oldpath itself under a
+// name that differs only by case.
+func (m *MemoryFileSystem) Rename(oldpath, newpath string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fail := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+
+	source, err := m.lookup(splitMemoryPath(oldpath))
+	if err != nil {
+		return fail(err)
+	}
+	if source == m.root {
+		return fail(fs.ErrInvalid)
+	}
+	parts := splitMemoryPath(newpath)
+	if len(parts) == 0 {
+		return fail(fs.ErrExist)
+	}
+	parent, err := m.lookupDir(parts[:len(parts)-1])
+	if err != nil {
+		return fail(err)
+	}
+	for ancestor := parent; ancestor != nil; ancestor = ancestor.parent {
+		if ancestor == source {
+			return fail(fs.ErrInvalid) // A directory can't be moved into itself
+		}
+	}
+	base := parts[len(parts)-1]
+	if target, ok := parent.children[m.cs.Key(base)]; ok && target != source {
+		return fail(fs.ErrExist)
+	}
+
+	source.parent.detach(m.cs, source)
+	source.name = base
+	parent.attach(m.cs, source)
+	return nil
+}
+
+// Mkdir creates a directory with the given permissions. The parent of the
+// directory must already exist.
+func (m *MemoryFileSystem) Mkdir(name string, perm fs.FileMode) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	parts := splitMemoryPath(name)
+	if len(parts) == 0 {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	parent, err := m.lookupDir(parts[:len(parts)-1])
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	base := parts[len(parts)-1]
+	if _, ok := parent.children[m.cs.Key(base)]; ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	node := parent.newChild(base, fs.ModeDir|perm.Perm())
+	node.modTime = time.Now()
+	node.loaded = true // A new directory has nothing to load
+	parent.attach(m.cs, node)
+	return nil
+}
+
+// Stat returns information about the named file.
+func (m *MemoryFileSystem) Stat(name string) (fs.FileInfo, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	node, err := m.lookup(splitMemoryPath(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return memoryFileInfo{
+		node:    node,
+		name:    node.name,
+		mode:    node.mode,
+		size:    node.size,
+		modTime: node.modTime,
+	}, nil
+}
+
+// Remove removes a file or an empty directory.
+func (m *MemoryFileSystem) Remove(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	node, err := m.lookup(splitMemoryPath(name))
+	if err == nil {
+		err = m.load(node)
+	}
+	switch {
+	case err != nil:
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	case node == m.root:
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	case len(node.children) > 0:
+		return &fs.PathError{Op: "remove", Path: name, Err: errDirectoryNotEmpty}
+	}
+	node.parent.detach(m.cs, node)
+	return nil
+}
+
+// lookup returns the node at the path made up of parts. The contents of
+// each directory along the way are loaded if necessary.
+func (m *MemoryFileSystem) lookup(parts []string) (*memoryNode, error) {
+	node := m.root
+	for _, part := range parts {
+		if !node.IsDir() {
+			return nil, errNotDirectory
+		}
+		if err := m.load(node); err != nil {
+			return nil, err
+		}
+		child, ok := node.children[m.cs.Key(part)]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// lookupDir returns the directory at the path made up of parts, with its
+// contents loaded.
+func (m *MemoryFileSystem) lookupDir(parts []string) (*memoryNode, error) {
+	node, err := m.lookup(parts)
+	if err != nil {
+		return nil, err
+	}
+	if !node.IsDir() {
+		return nil, errNotDirectory
+	}
+	if err := m.load(node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// load reads the contents of the directory n from the file system it was
+// mounted from, if that hasn't been done already. Files that are already
+// present in n are kept as they are. A directory that no longer exists in
+// the mounted file system is treated as empty.
+func (m *MemoryFileSystem) load(n *memoryNode) error {
+	if n.loaded || !n.IsDir() {
+		return nil
+	}
+	if n.base != nil {
+		entries, err := fs.ReadDir(n.base, n.origin)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		for _, entry := range entries {
+			if _, exists := n.children[m.cs.Key(entry.Name())]; exists {
+				continue
+			}
+			n.attach(m.cs, n.newChild(entry.Name(), entry.Type()))
+		}
+	}
+	n.loaded = true
+	return nil
+}
+
+// splitMemoryPath breaks name into its elements. Both forward slashes and
+// the local path separator are accepted. The root is returned as an empty
+// slice.
+func splitMemoryPath(name string) []string {
+	p := path.Clean("/" + filepath.ToSlash(name))
+	if p == "/" {
+		return nil
+	}
+	return strings.Split(p[1:], "/")
+}
+
+// memoryNode is a file or directory within a MemoryFileSystem.
+type memoryNode struct {
+	name     string
+	mode     fs.FileMode
+	size     int64
+	modTime  time.Time
+	parent   *memoryNode
+	children map[string]*memoryNode // Keyed by name according to case sensitivity
+	base     fs.FS                  // The mounted file system the node came from, if any
+	origin   string                 // The path of the node within base
+	loaded   bool                   // Whether the contents have been read from base
+}
+
+// newMemoryNode returns a node with the given name and mode, which came from
+// origin within base.
+func newMemoryNode(name string, mode fs.FileMode, base fs.FS, origin string) *memoryNode {
+	node := &memoryNode{name: name, mode: mode, base: base, origin: origin}
+	if mode.IsDir() {
+		node.children = make(map[string]*memoryNode)
+	}
+	return node
+}
+
+// newChild returns a node that can be attached to n. If n came from a
+// mounted file system, so does the child.
+func (n *memoryNode) newChild(name string, mode fs.FileMode) *memoryNode {
+	if n.base == nil {
+		return newMemoryNode(name, mode, nil, "")
+	}
+	return newMemoryNode(name, mode, n.base, path.Join(n.origin, name))
+}
+
+// IsDir returns true if n is a directory.
+func (n *memoryNode) IsDir() bool {
+	return n.mode.IsDir()
+}
+
+// attach adds child to the contents of n.
+func (n *memoryNode) attach(cs CaseSensitivity, child *memoryNode) {
+	child.parent = n
+	n.children[cs.Key(child.name)] = child
+}
+
+// detach removes child from the contents of n.
+func (n *memoryNode) detach(cs CaseSensitivity, child *memoryNode) {
+	delete(n.children, cs.Key(child.name))
+	child.parent = nil
+}
+
+// memoryFileInfo describes a memoryNode at the time it was looked up.
+type memoryFileInfo struct {
+	node    *memoryNode
+	name    string
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+}
+
+func (fi memoryFileInfo) Name() string       { return fi.name }
+func (fi memoryFileInfo) Size() int64        { return fi.size }
+func (fi memoryFileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi memoryFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi memoryFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi memoryFileInfo) Sys() interface{}   { return nil }
@@ -1,13 +1,21 @@
-package main
+package refret
 
 import "path"
 
 // Omit stores information about scanned files that will be omitted from the
 // action list
 type Omit struct {
-	Path string
+	Path   string
+	Reason string
 }
 
+// Omission reasons
+const (
+	NotMatchedReason = "not matched"
+	ExcludedReason   = "excluded by "
+	VanishedReason   = "no longer exists"
+)
+
 // String returns a string representation of the omitted file.
 func (o Omit) String() string {
 	return o.Path
@@ -21,8 +29,13 @@ func BuildOmitted(files []File) (omitted []Omit) {
 	}
 	action := func(file File) {
 		if file.Result != Matched {
+			reason := file.Reason
+			if reason == "" {
+				reason = NotMatchedReason
+			}
 			omitted = append(omitted, Omit{
-				Path: path.Join(file.Parent, file.Name),
+				Path:   path.Join(file.Parent, file.Name),
+				Reason: reason,
 			})
 		}
 	}
@@ -0,0 +1,176 @@
+package refret
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Overlay errors
+var (
+	ErrSourceMissing      = errors.New("source does not exist")
+	ErrTargetExists       = errors.New("target already exists")
+	ErrParentMissing      = errors.New("target parent directory does not exist")
+	ErrTargetWithinSource = errors.New("target is within source")
+	ErrNotDirectory       = errors.New("source is not a directory")
+	ErrDirectoryNotEmpty  = errors.New("directory is not empty")
+	ErrUnknownOperation   = errors.New("unknown operation")
+)
+
+// Overlay tracks a series of proposed actions on top of a file system
+// without modifying it. It can be used to determine whether each action in a
+// series would be valid at the point it is reached.
+//
+// The overlay holds a copy of the parts of the file system that the actions
+// have touched in memory, and reads the contents of each directory from the
+// file system when it is first needed. Files that have been moved keep their
+// contents, wherever they are moved to.
+//
+// Paths are slash-separated and relative to the root of the file system.
+type Overlay struct {
+	fsys *MemoryFileSystem
+}
+
+// NewOverlay returns an empty overlay for the file system at root, which
+// compares names according to cs.
+func NewOverlay(root string, cs CaseSensitivity) *Overlay {
+	fsys := NewMemoryFileSystem(cs)
+	fsys.Mount(".", os.DirFS(root)) // Mounting at the root can't fail
+	return &Overlay{fsys: fsys}
+}
+
+// Exists returns true if a file exists at p, taking into account all of the
+// actions that have been applied to the overlay.
+func (o *Overlay) Exists(p string) (bool, error) {
+	_, err := o.stat(p)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Apply records the given action in the overlay. It returns one of the
+// overlay errors if the action would fail.
+func (o *Overlay) Apply(action Action) error {
+	op := action.Operation()
+	switch op {
+	case RenameOperation, RmdirOperation:
+		if err := o.require(action.OldPath, true, ErrSourceMissing); err != nil {
+			return err
+		}
+	case MkdirOperation:
+	default:
+		return ErrUnknownOperation
+	}
+	switch op {
+	case RenameOperation, MkdirOperation:
+		if err := o.require(action.NewPath, false, ErrTargetExists); err != nil {
+			// On case-insensitive file systems the target of a case-only
+			// rename is the source itself
+			if err != ErrTargetExists || op != RenameOperation || !isCaseOnly(action.OldPath, action.NewPath) || !o.same(action.OldPath, action.NewPath) {
+				return err
+			}
+		}
+		if parent := path.Dir(action.NewPath); parent != "." {
+			info, err := o.stat(parent)
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				return ErrParentMissing
+			case err != nil:
+				return err
+			case !info.IsDir():
+				return ErrParentMissing
+			}
+		}
+	}
+	switch op {
+	case RenameOperation:
+		if err := o.fsys.Rename(action.OldPath, action.NewPath); err != nil {
+			if errors.Is(err, fs.ErrInvalid) {
+				return ErrTargetWithinSource
+			}
+			return err
+		}
+	case MkdirOperation:
+		if err := o.fsys.Mkdir(action.NewPath, 0755); err != nil {
+			return err
+		}
+	case RmdirOperation:
+		info, err := o.stat(action.OldPath)
+		switch {
+		case err != nil:
+			return err
+		case !info.IsDir():
+			return ErrNotDirectory
+		}
+		if err := o.fsys.Remove(action.OldPath); err != nil {
+			if errors.Is(err, errDirectoryNotEmpty) {
+				return ErrDirectoryNotEmpty
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// stat returns information about the file at p. A path that passes through
+// a file that isn't a directory does not exist.
+func (o *Overlay) stat(p string) (fs.FileInfo, error) {
+	info, err := o.fsys.Stat(p)
+	if errors.Is(err, errNotDirectory) {
+		return nil, &fs.PathError{Op: "lstat", Path: p, Err: fs.ErrNotExist}
+	}
+	return info, err
+}
+
+// same returns true if a and b refer to the same file.
+func (o *Overlay) same(a, b string) bool {
+	infoA, err := o.stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := o.stat(b)
+	if err != nil {
+		return false
+	}
+	return sameFile(infoA, infoB)
+}
+
+// require returns failure if the existence of a file at p does not match
+// exists.
+func (o *Overlay) require(p string, exists bool, failure error) error {
+	found, err := o.Exists(p)
+	if err != nil {
+		return err
+	}
+	if found != exists {
+		return failure
+	}
+	return nil
+}
+
+// validatePath returns an error if p is not a clean, relative,
+// slash-separated path that stays within the root.
+func validatePath(p string) error {
+	switch {
+	case p == "":
+		return fmt.Errorf("empty path")
+	case p == ".":
+		return fmt.Errorf("path refers to root")
+	case path.IsAbs(p) || filepath.IsAbs(p):
+		return fmt.Errorf("path is absolute: %s", p)
+	case path.Clean(p) != p:
+		return fmt.Errorf("path is not clean: %s", p)
+	case p == ".." || strings.HasPrefix(p, "../"):
+		return fmt.Errorf("path is outside of root: %s", p)
+	}
+	return nil
+}
@@ -1,51 +1,166 @@
-package main
+package refret
 
 import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 )
 
+// CaseMode determines whether a pattern matches names case-sensitively.
+type CaseMode int
+
+// Pattern case modes
+const (
+	DefaultCase CaseMode = 0 // Use the default mode
+	IgnoreCase  CaseMode = 1 // Match regardless of case
+	MatchCase   CaseMode = 2 // Match case exactly
+)
+
+// String returns a string representation of mode.
+func (mode CaseMode) String() string {
+	switch mode {
+	case MatchCase:
+		return "Case-Sensitive"
+	case IgnoreCase:
+		return "Case-Insensitive"
+	default:
+		return "Default"
+	}
+}
+
 // Pattern is a file matching pattern than optionally can also specify
 // substitutions.
 type Pattern struct {
 	Expression  *regexp.Regexp
 	Subtitution string
+	Recursive   bool        // Matches zero or more directory levels (**)
+	Case        CaseMode    // The case mode requested by the pattern's flags
+	Conditions  []Condition // Conditions that matching files must satisfy
+	Exclusions  []Exclusion // Expressions that matching files must not match
+	Comment     string      // A description of the pattern's purpose
+	Rules       []Pattern   // Alternative rules that follow the pattern's own (unreachable in FirstMatch mode if it has no expression)
+	Mode        RuleMode    // How the pattern's rules are applied
+
+	source      string       // The expression as written
+	defaultCase CaseMode     // The case mode used when Case is DefaultCase
+	template    substitution // The parsed substitution
 }
 
 // UnmarshalText unmarshals the given text as a patter in p.
+//
+// See parsePattern for a description of the pattern syntax, and
+// parseSubstitution for a description of the substitution syntax. A pattern
+// prefixed with "glob:" has an expression written as a glob instead of a
+// regular expression, as described by globToRegex. The following flags are
+// supported in the sed: form:
+//
+//	i  Match regardless of case
+//	c  Match case exactly
 func (p *Pattern) UnmarshalText(text []byte) error {
 	re := string(text)
 
 	// Interpret special values as no-ops
 	if re == "" || re == "_" {
-		p.Expression = nil
-		p.Subtitution = ""
+		*p = Pattern{}
 		return nil
 	}
 
-	// If the expression contains a forward slash, interpret it as a delimiter
-	// between the expression and the substitution
-	sub := ""
-	if pair := strings.SplitN(re, "/", 2); len(pair) == 2 {
-		re = pair[0]
-		sub = pair[1]
-		if sub == "" {
-			return errors.New("empty substitution provided in pattern")
-		}
+	// Interpret a double asterisk as a recursive pattern
+	if re == "**" {
+		*p = Pattern{Recursive: true}
+		return nil
 	}
-	exp, err := compileRegex(re)
+
+	// Parse a glob expression after its prefix
+	glob := strings.HasPrefix(re, globPrefix)
+	offset := 0
+	if glob {
+		offset = len(globPrefix)
+	}
+
+	syntax, err := parsePattern(re[offset:])
 	if err != nil {
+		if perr, ok := err.(*PatternError); ok {
+			return &PatternError{Pattern: re, Column: perr.Column + offset, Message: perr.Message}
+		}
 		return err
 	}
-	p.Expression = exp
-	p.Subtitution = sub
+	syntax.ExpressionColumns = offsetColumns(syntax.ExpressionColumns, offset)
+	syntax.SubstitutionColumns = offsetColumns(syntax.SubstitutionColumns, offset)
+	syntax.FlagsColumns = offsetColumns(syntax.FlagsColumns, offset)
+	return p.build(re, syntax, glob)
+}
+
+// build prepares p from the parts of a pattern. If glob is true, the
+// expression is a glob. The text of the pattern is used to report errors.
+func (p *Pattern) build(re string, syntax patternSyntax, glob bool) error {
+	if syntax.Expression == "" && syntax.Substitution != "" {
+		return &PatternError{Pattern: re, Column: column(syntax.ExpressionColumns, 0), Message: "empty expression provided in pattern"}
+	}
+	if glob {
+		expression, index, err := globToRegex(syntax.Expression)
+		if err != nil {
+			return &PatternError{Pattern: re, Column: column(syntax.ExpressionColumns, index), Message: err.Error()}
+		}
+		syntax.Expression = expression
+	}
+	mode, index, err := parseFlags(syntax.Flags)
+	if err != nil {
+		return &PatternError{Pattern: re, Column: column(syntax.FlagsColumns, index), Message: err.Error()}
+	}
+	template, index, err := parseSubstitution(syntax.Substitution)
+	if err != nil {
+		at := column(syntax.SubstitutionColumns, len([]rune(syntax.Substitution[:index])))
+		return &PatternError{Pattern: re, Column: at, Message: err.Error()}
+	}
+	*p = Pattern{
+		Subtitution: syntax.Substitution,
+		Case:        mode,
+		source:      syntax.Expression,
+		template:    template,
+	}
+	if err := p.compile(); err != nil {
+		return &PatternError{Pattern: re, Column: column(syntax.ExpressionColumns, 0), Message: err.Error()}
+	}
 	return nil
 }
 
+// SetDefaultCase sets the case mode used by p when its flags don't specify
+// one. The default mode is IgnoreCase.
+func (p *Pattern) SetDefaultCase(mode CaseMode) error {
+	p.defaultCase = mode
+	for i := range p.Exclusions {
+		if err := p.Exclusions[i].SetDefaultCase(mode); err != nil {
+			return err
+		}
+	}
+	for i := range p.Rules {
+		if err := p.Rules[i].SetDefaultCase(mode); err != nil {
+			return err
+		}
+	}
+	return p.compile()
+}
+
+// EffectiveCase returns the case mode in effect for p.
+func (p Pattern) EffectiveCase() CaseMode {
+	switch {
+	case p.Case != DefaultCase:
+		return p.Case
+	case p.defaultCase != DefaultCase:
+		return p.defaultCase
+	default:
+		return IgnoreCase
+	}
+}
+
 // String returns a string representation of the pattern.
 func (p Pattern) String() string {
+	if p.Recursive {
+		return "**"
+	}
 	if p.Expression == nil {
 		return "*"
 	}
@@ -55,38 +170,240 @@ func (p Pattern) String() string {
 	return fmt.Sprintf("%s / %s", p.Expression, p.Subtitution)
 }
 
-// ApplyPattern selects an appropriate pattern for the given traversal depth,
-// applies it to value, returned the result of the match.
+func (p *Pattern) compile() error {
+	exp, err := compileRegex(p.source, p.EffectiveCase() != MatchCase)
+	if err != nil {
+		return err
+	}
+	p.Expression = exp
+	return nil
+}
+
+// NeedsMetadata returns true if p or any of its rules use metadata that
+// isn't available from a directory listing, such as the size, modification
+// time or permissions of a file. The type of a file is always available.
+func (p Pattern) NeedsMetadata() bool {
+	for _, condition := range p.Conditions {
+		if condition.Field != "type" {
+			return true
+		}
+	}
+	if p.template.NeedsMetadata() {
+		return true
+	}
+	for _, rule := range p.Rules {
+		if rule.NeedsMetadata() {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply applies p to the file described by vars and returns the result of
+// the match, along with a description of the rules that were applied.
+//
+// If p has conditions, the file must satisfy all of them to match. If p has
+// exclusions, the file's name must not match any of them.
+//
+// The pattern's own expression and substitution form its first rule, and
+// its alternative rules follow. In FirstMatch mode, the first rule that
+// matches is applied. In Chain mode, each rule that matches is applied in
+// turn to the name produced by the rules before it. The file matches if any
+// of the rules match.
+//
+// If a rule supplies a substitution, it is applied to the name of the file
+// and the substituted name is returned. Otherwise, the original name is
+// returned.
 //
-// If the selected pattern supplies a substitution, it is applied and the
-// substituted value is returned. Otherwise, the original value is returned.
-func ApplyPattern(patterns []Pattern, depth int, value string) (result Match, newValue string) {
-	if depth >= len(patterns) {
-		return NoPattern, value
-	}
-	pattern := patterns[depth]
-	if pattern.Expression == nil {
-		if pattern.Subtitution != "" {
+// Substitutions may include the case transformation operators \U, \L, \u,
+// \l and \E, which convert the case of the text that follows them,
+// including the contents of capture groups. They may also include
+// placeholders, which are filled in from vars.
+func (p Pattern) Apply(vars Vars) (result Match, newName string, rule string) {
+	result, newName, applied := p.apply(vars)
+	return result, newName, p.describeRules(applied)
+}
+
+// apply applies p to vars in the same way as Apply. It returns the indices
+// of the rules that were applied, in the order they were applied, with -1
+// standing for p's own expression and substitution.
+func (p Pattern) apply(vars Vars) (result Match, newName string, applied []int) {
+	for _, condition := range p.Conditions {
+		if !condition.Test(vars) {
+			return NotMatched, vars.Name, nil
+		}
+	}
+	if _, excluded := p.Excludes(vars.Name); excluded {
+		return NotMatched, vars.Name, nil
+	}
+	if p.Recursive {
+		if vars.Mode.IsDir() {
+			return Matched, vars.Name, nil
+		}
+		return NotMatched, vars.Name, nil
+	}
+	result, newName = NotMatched, vars.Name
+	for i := -1; i < len(p.Rules); i++ {
+		vars.Name = newName
+		matched, name := p.rule(i).applyRule(vars)
+		if matched != Matched {
+			continue
+		}
+		result, newName = Matched, name
+		applied = append(applied, i)
+		if p.Mode != Chain {
+			break
+		}
+	}
+	return result, newName, applied
+}
+
+// rule returns the rule of p at index i, or p itself if i is -1.
+func (p Pattern) rule(i int) Pattern {
+	if i < 0 {
+		return p
+	}
+	return p.Rules[i]
+}
+
+// describeRules returns a description of the given rules of p, for review.
+func (p Pattern) describeRules(applied []int) string {
+	descriptions := make([]string, len(applied))
+	for i, index := range applied {
+		descriptions[i] = p.rule(index).String()
+	}
+	return strings.Join(descriptions, " + ")
+}
+
+// Excludes returns the first of p's exclusions that matches name, if any.
+func (p Pattern) Excludes(name string) (exclusion Exclusion, excluded bool) {
+	for _, exclusion := range p.Exclusions {
+		if exclusion.Excludes(name) {
+			return exclusion, true
+		}
+	}
+	return Exclusion{}, false
+}
+
+// applyRule applies the expression and substitution of p to vars.Name.
+func (p Pattern) applyRule(vars Vars) (result Match, newName string) {
+	if p.Expression == nil {
+		if p.Subtitution != "" {
 			panic("unexpected substitution with nil pattern expression")
 		}
-		return Matched, value
+		return Matched, vars.Name
 	}
-	if pattern.Expression.MatchString(value) {
-		if pattern.Subtitution == "" {
-			return Matched, value
+	if p.Expression.MatchString(vars.Name) {
+		if p.Subtitution == "" {
+			return Matched, vars.Name
 		}
-		return Matched, pattern.Expression.ReplaceAllString(value, pattern.Subtitution)
+		return Matched, p.template.Replace(p.Expression, vars.Name, vars)
+	}
+	return NotMatched, vars.Name
+}
+
+// Counters returns the counters used by the substitutions of p's rules.
+func (p Pattern) Counters() (counters []Counter) {
+	counters = p.template.Counters()
+	for _, rule := range p.Rules {
+		counters = append(counters, rule.Counters()...)
 	}
-	return NotMatched, value
+	return counters
 }
 
-func compileRegex(re string) (*regexp.Regexp, error) {
+// appliedCounters returns the counters used by the substitutions of the
+// given rules of p, as returned by apply.
+func (p Pattern) appliedCounters(applied []int) (counters []Counter) {
+	for _, index := range applied {
+		counters = append(counters, p.rule(index).template.Counters()...)
+	}
+	return counters
+}
+
+// StartPositions returns the positions within patterns that apply to the
+// files at the root of a file system.
+func StartPositions(patterns []Pattern) []int {
+	return addPosition(nil, patterns, 0)
+}
+
+// ApplyPattern applies the patterns at each of the given positions to the
+// file described by vars, and returns the result of the match.
+//
+// Ordinarily there is a single position, which is the traversal depth of the
+// file. Recursive patterns (**) match zero or more directory levels, so the
+// patterns that follow them may apply at several positions. The first
+// non-recursive pattern that matches determines the new name of the file,
+// and its position is returned as pattern, or -1 if there isn't one. A
+// description of the pattern's rules that were applied is returned as rule.
+//
+// The positions of the patterns that apply to the contents of the file are
+// returned as next.
+func ApplyPattern(patterns []Pattern, positions []int, vars Vars) (result Match, newName string, pattern int, rule string, next []int) {
+	result, newName, pattern, applied, next := applyPatterns(patterns, positions, vars)
+	if pattern >= 0 {
+		rule = patterns[pattern].describeRules(applied)
+	}
+	return result, newName, pattern, rule, next
+}
+
+// applyPatterns applies patterns in the same way as ApplyPattern. It returns
+// the indices of the rules of the matching pattern that were applied, as
+// returned by Pattern.apply.
+func applyPatterns(patterns []Pattern, positions []int, vars Vars) (result Match, newName string, pattern int, applied []int, next []int) {
+	result, newName, pattern = NoPattern, vars.Name, -1
+	for _, position := range positions {
+		if position >= len(patterns) {
+			continue
+		}
+		if result == NoPattern {
+			result = NotMatched
+		}
+		p := patterns[position]
+		matched, name, rules := p.apply(vars)
+		if matched != Matched {
+			continue
+		}
+		if p.Recursive {
+			// The pattern consumes this directory and may consume more
+			next = addPosition(next, patterns, position)
+			result = Matched
+			continue
+		}
+		next = addPosition(next, patterns, position+1)
+		if pattern < 0 {
+			result, newName, pattern, applied = Matched, name, position, rules
+		}
+	}
+	return result, newName, pattern, applied, next
+}
+
+// addPosition adds position to positions, along with the positions that
+// follow any recursive patterns at position, because recursive patterns
+// may match zero directory levels. Positions beyond the end of patterns are
+// ignored. The positions are kept in ascending order.
+func addPosition(positions []int, patterns []Pattern, position int) []int {
+	for ; position < len(patterns); position++ {
+		i := sort.SearchInts(positions, position)
+		if i == len(positions) || positions[i] != position {
+			positions = append(positions, 0)
+			copy(positions[i+1:], positions[i:])
+			positions[i] = position
+		}
+		if !patterns[position].Recursive {
+			break
+		}
+	}
+	return positions
+}
+
+func compileRegex(re string, insensitive bool) (*regexp.Regexp, error) {
 	if re == "" {
 		return nil, nil
 	}
 
-	// Force case-insensitive matching
-	if !strings.HasPrefix(re, "(?i)") {
+	// Force case-insensitive matching unless case-sensitive matching was
+	// requested
+	if insensitive && !strings.HasPrefix(re, "(?i)") {
 		re = "(?i)" + re
 	}
 
@@ -96,3 +413,25 @@ func compileRegex(re string) (*regexp.Regexp, error) {
 	}
 	return c, nil
 }
+
+// parseFlags returns the case mode requested by a set of pattern flags.
+// If the flags are invalid, it also returns the index of the offending flag.
+func parseFlags(flags string) (mode CaseMode, index int, err error) {
+	for i, flag := range []rune(flags) {
+		switch flag {
+		case 'i':
+			if mode == MatchCase {
+				return DefaultCase, i, errors.New("conflicting case flags provided in pattern")
+			}
+			mode = IgnoreCase
+		case 'c':
+			if mode == IgnoreCase {
+				return DefaultCase, i, errors.New("conflicting case flags provided in pattern")
+			}
+			mode = MatchCase
+		default:
+			return DefaultCase, i, fmt.Errorf("unknown flag \"%c\" provided in pattern", flag)
+		}
+	}
+	return mode, 0, nil
+}
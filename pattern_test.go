@@ -0,0 +1,89 @@
+package refret
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPatternErrors(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Column  int
+	}{
+		{`sed:s/a/b/q`, 11},          // Unknown flag
+		{`sed:s/a/\Ub/x`, 13},        // Unknown flag after an operator
+		{`sed:s|a|b`, 10},            // Missing closing delimiter
+		{`sed:s|(|b|`, 7},            // Invalid expression
+		{`/x`, 1},                    // Empty expression with a substitution
+		{`a/b\`, 4},                  // Incomplete escape sequence
+		{`glob:{a,b/x`, 6},           // Unterminated brace
+		{`glob:sed:s|a\|[b|x|`, 15},  // Escaped delimiter before the problem
+		{`glob:sed:s|\|\|[b|x|`, 16}, // Several escaped delimiters
+	}
+	for _, test := range tests {
+		var p Pattern
+		err := p.UnmarshalText([]byte(test.Pattern))
+		var perr *PatternError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: expected a pattern error, got %v", test.Pattern, err)
+			continue
+		}
+		if perr.Column != test.Column {
+			t.Errorf("%s: expected column %d, got %d: %v", test.Pattern, test.Column, perr.Column, err)
+		}
+	}
+}
+
+func TestPatternApply(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Name    string
+		NewName string
+	}{
+		// Delimiters
+		{`^a(.*)$/b$1`, "abc", "bbc"},
+		{`sed:s|^a(.*)$|b$1|`, "abc", "bbc"},
+		{`sed:s#a\#b#c#`, "a#b", "c"},
+		{`sed:s|^(a\|b)$|c|`, "b", "c"}, // An escaped delimiter keeps its meaning in the expression
+		{`sed:s!a\!!b!`, "a!", "b"},
+		{`sed:s/abc/x/i`, "ABC", "x"},
+		{`sed:s/abc/x/c`, "ABC", "ABC"},
+
+		// Case transformation operators
+		{`^(.*)$/\L$1`, "HELLO", "hello"},
+		{`^(.*)$/\U$1`, "hello", "HELLO"},
+		{`^(\w)(.*)$/\u$1$2`, "abc", "Abc"},
+		{`^(\w)(.*)$/\l$1$2`, "ABC", "aBC"},
+		{`^(\w)(.*)$/\u$1\U$2\E!`, "abc", "ABC!"},
+		{`^(.*)-(.*)$/\U$1\E-$2`, "ab-cd", "AB-cd"},
+
+		// Capture groups, placeholders and literal braces
+		{`^(.*)$/${1}b`, "a", "ab"},
+		{`^(.*)$/$$$1`, "a", "$a"},
+		{`^(.*)$/$${n}`, "a", "$1"},
+		{`^(.*)$/{n:start=5}-$1`, "a", "5-a"},
+		{`^(.*)$/{x}$1`, "a", "{x}a"},
+		{`^(.*)$/{$1}`, "a", "{a}"},
+		{`^(.*)$/\{n\}$1`, "a", "{n}a"},
+		{`^(.*)$/${1`, "a", "${1"},
+
+		// Globs
+		{`glob:*.jpeg/$1.jpg`, "photo.jpeg", "photo.jpg"},
+		{`glob:IMG_???.jpg/$1$2$3`, "IMG_123.jpg", "123"},
+		{`glob:{IMG,DSC}_*.jpg/$1`, "DSC_x.jpg", "x"},
+		{`glob:*.{jpg,jpeg}/$1`, "photo.jpeg", "photo"},
+		{`glob:[!a]*/$2`, "bcd", "cd"},
+		{`glob:\*/star`, "*", "star"},
+		{`glob:*.jpg/x`, "photo.png", "photo.png"},
+	}
+	for _, test := range tests {
+		var p Pattern
+		if err := p.UnmarshalText([]byte(test.Pattern)); err != nil {
+			t.Errorf("%s: %v", test.Pattern, err)
+			continue
+		}
+		if _, newName, _ := p.Apply(Vars{Name: test.Name}); newName != test.NewName {
+			t.Errorf("%s: expected \"%s\" to become \"%s\", got \"%s\"", test.Pattern, test.Name, test.NewName, newName)
+		}
+	}
+}
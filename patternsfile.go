@@ -0,0 +1,137 @@
+package refret
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// PatternsFile describes a set of patterns that are stored in a file, so
+// that they can be reviewed without shell quoting. It can be written in
+// JSON, YAML or TOML.
+type PatternsFile struct {
+	Patterns []PatternEntry `json:"patterns" yaml:"patterns" toml:"patterns"`
+}
+
+// PatternEntry describes the pattern for a single depth in a patterns file.
+//
+// The expression, substitution and flags are written exactly as they would
+// be within a pattern on the command line, without delimiters or escaping.
+// An expression prefixed with "glob:" is a glob. An empty expression or an
+// underscore matches everything, and a double asterisk is recursive.
+type PatternEntry struct {
+	Comment      string `json:"comment,omitempty" yaml:"comment,omitempty" toml:"comment,omitempty"`
+	Expression   string `json:"expression" yaml:"expression" toml:"expression"`
+	Substitution string `json:"substitution,omitempty" yaml:"substitution,omitempty" toml:"substitution,omitempty"`
+	Flags        string `json:"flags,omitempty" yaml:"flags,omitempty" toml:"flags,omitempty"`
+}
+
+// Pattern returns the pattern described by entry.
+func (entry PatternEntry) Pattern() (p Pattern, err error) {
+	// Describe the entry in the pattern syntax for the sake of errors
+	text := entry.Expression
+	if entry.Substitution != "" || entry.Flags != "" {
+		text += "/" + entry.Substitution
+	}
+	if entry.Flags != "" {
+		text += "/" + entry.Flags
+	}
+
+	switch {
+	case entry.Substitution != "" || entry.Flags != "":
+	case entry.Expression == "" || entry.Expression == "_":
+		return Pattern{Comment: entry.Comment}, nil
+	case entry.Expression == "**":
+		return Pattern{Recursive: true, Comment: entry.Comment}, nil
+	}
+
+	glob := strings.HasPrefix(entry.Expression, globPrefix)
+	syntax := patternSyntax{
+		Expression:          strings.TrimPrefix(entry.Expression, globPrefix),
+		Substitution:        entry.Substitution,
+		Flags:               entry.Flags,
+		SubstitutionColumns: sequentialColumns(entry.Substitution, len([]rune(entry.Expression))+2),
+		FlagsColumns:        sequentialColumns(entry.Flags, len([]rune(entry.Expression+entry.Substitution))+3),
+	}
+	syntax.ExpressionColumns = sequentialColumns(syntax.Expression, 1)
+	if glob {
+		syntax.ExpressionColumns = offsetColumns(syntax.ExpressionColumns, len(globPrefix))
+	}
+	if err := p.build(text, syntax, glob); err != nil {
+		return Pattern{}, err
+	}
+	p.Comment = entry.Comment
+	return p, nil
+}
+
+// LoadPatterns reads the patterns in a patterns file. It also returns the
+// SHA-256 hash of the file's contents, so that the outcome of a run can be
+// traced back to the exact patterns that produced it. Each pattern is
+// validated as it is loaded.
+//
+// Files with a .yaml or .yml extension are read as YAML, and files with a
+// .toml extension are read as TOML. All other files are read as JSON. Fields
+// that aren't part of PatternsFile are rejected in every format, so that
+// misspelled fields aren't silently ignored.
+func LoadPatterns(path string) (patterns []Pattern, hash string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	hash = hex.EncodeToString(sum[:])
+
+	file, err := decodePatternsFile(data, strings.ToLower(filepath.Ext(path)))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(file.Patterns) == 0 {
+		return nil, "", fmt.Errorf("no patterns are defined")
+	}
+
+	for depth, entry := range file.Patterns {
+		pattern, err := entry.Pattern()
+		if err != nil {
+			return nil, "", fmt.Errorf("depth %d: %v", depth, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, hash, nil
+}
+
+// decodePatternsFile decodes the contents of a patterns file in the format
+// indicated by its extension.
+func decodePatternsFile(data []byte, ext string) (file PatternsFile, err error) {
+	switch ext {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil && err != io.EOF {
+			return PatternsFile{}, err
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), &file)
+		if err != nil {
+			return PatternsFile{}, err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return PatternsFile{}, fmt.Errorf("unknown field \"%s\"", undecoded[0])
+		}
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return PatternsFile{}, err
+		}
+	}
+	return file, nil
+}
@@ -0,0 +1,104 @@
+package refret
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePatternsFile writes contents to a file with the given name in a
+// temporary directory and returns its path.
+func writePatternsFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoadPatterns(t *testing.T) {
+	files := map[string]string{
+		"patterns.json": `{
+	"patterns": [
+		{"comment": "Clients", "expression": "^(.*) - (\\d+)$", "substitution": "$1/$2"},
+		{"expression": "**"},
+		{"expression": "glob:*.JPG", "substitution": "$1.jpg", "flags": "c"}
+	]
+}`,
+		"patterns.yaml": `patterns:
+  - comment: Clients
+    expression: '^(.*) - (\d+)$'
+    substitution: $1/$2
+  - expression: "**"
+  - expression: glob:*.JPG
+    substitution: $1.jpg
+    flags: c
+`,
+		"patterns.toml": `[[patterns]]
+comment = "Clients"
+expression = '^(.*) - (\d+)$'
+substitution = "$1/$2"
+
+[[patterns]]
+expression = "**"
+
+[[patterns]]
+expression = "glob:*.JPG"
+substitution = "$1.jpg"
+flags = "c"
+`,
+	}
+	files["patterns.yml"] = files["patterns.yaml"]
+
+	for name, contents := range files {
+		t.Run(name, func(t *testing.T) {
+			patterns, hash, err := LoadPatterns(writePatternsFile(t, name, contents))
+			if err != nil {
+				t.Fatalf("failed to load patterns: %v", err)
+			}
+			sum := sha256.Sum256([]byte(contents))
+			if want := hex.EncodeToString(sum[:]); hash != want {
+				t.Errorf("hash is not of the file's contents: got %s, want %s", hash, want)
+			}
+			if len(patterns) != 3 {
+				t.Fatalf("expected 3 patterns, got %d", len(patterns))
+			}
+			if patterns[0].Comment != "Clients" {
+				t.Errorf("unexpected comment: %q", patterns[0].Comment)
+			}
+			if _, newName, _ := patterns[0].Apply(Vars{Name: "Acme - 2020"}); newName != "Acme/2020" {
+				t.Errorf("unexpected name from first pattern: %s", newName)
+			}
+			if !patterns[1].Recursive {
+				t.Errorf("second pattern is not recursive")
+			}
+			if patterns[2].Case != MatchCase {
+				t.Errorf("flags of third pattern were not applied")
+			}
+			if _, newName, _ := patterns[2].Apply(Vars{Name: "photo.JPG"}); newName != "photo.jpg" {
+				t.Errorf("unexpected name from third pattern: %s", newName)
+			}
+		})
+	}
+}
+
+func TestLoadPatternsErrors(t *testing.T) {
+	files := map[string]string{
+		"unknown.json": `{"patterns": [{"expresion": "a"}]}`,
+		"unknown.yaml": "patterns:\n  - expresion: a\n",
+		"unknown.toml": "[[patterns]]\nexpresion = \"a\"\n",
+		"empty.json":   `{"patterns": []}`,
+		"empty.yaml":   "",
+		"empty.toml":   "",
+		"invalid.yaml": "patterns:\n  - expression: \"\"\n    substitution: x\n",
+		"invalid.toml": "[[patterns]]\nexpression = \"(\"\n",
+	}
+	for name, contents := range files {
+		if _, _, err := LoadPatterns(writePatternsFile(t, name, contents)); err == nil {
+			t.Errorf("%s: loaded without an error", name)
+		}
+	}
+}
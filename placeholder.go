@@ -0,0 +1,155 @@
+package refret
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// placeholderKind identifies the kind of value a placeholder produces.
+type placeholderKind string
+
+// Placeholder kinds
+const (
+	counterPlaceholder placeholderKind = "n"     // A sequence number
+	mtimePlaceholder   placeholderKind = "mtime" // The modification time
+	sizePlaceholder    placeholderKind = "size"  // The size in bytes
+	basePlaceholder    placeholderKind = "base"  // The name without its extension
+	extPlaceholder     placeholderKind = "ext"   // The extension, including its dot
+)
+
+// defaultTimeLayout is the layout used by time placeholders that don't
+// specify one.
+const defaultTimeLayout = "2006-01-02"
+
+// placeholder is a value within a substitution that is not derived from
+// the name of a file.
+type placeholder struct {
+	Kind placeholderKind
+
+	// Counter options
+	Counter Counter
+	Start   int
+	Step    int
+	Pad     int
+
+	// Time options
+	Layout string
+}
+
+// isPlaceholder returns true if contents, which is the text between a pair
+// of braces, starts with the kind of a known placeholder.
+func isPlaceholder(contents string) bool {
+	kind := contents
+	if i := strings.IndexByte(contents, ':'); i >= 0 {
+		kind = contents[:i]
+	}
+	switch placeholderKind(kind) {
+	case counterPlaceholder, mtimePlaceholder, sizePlaceholder, basePlaceholder, extPlaceholder:
+		return true
+	default:
+		return false
+	}
+}
+
+// parsePlaceholder parses the contents of a placeholder, which is the text
+// between its braces. The contents are a kind, optionally followed by a
+// colon and options.
+//
+// The following kinds are supported:
+//
+//	n      A sequence number
+//	mtime  The modification time of the file
+//	size   The size of the file in bytes
+//	base   The name of the file without its extension
+//	ext    The extension of the file, including its dot
+//
+// The options for mtime are a Go time layout (default 2006-01-02). The
+// options for n are a comma-separated list of key=value pairs:
+//
+//	start  The first number in the sequence (default 1)
+//	step   The difference between successive numbers (default 1)
+//	pad    The minimum number of digits, padded with zeros (default 0)
+//	scope  The files numbered by the sequence: parent, depth or global
+//	       (default parent)
+//	order  The order in which files are numbered: index or name
+//	       (default index)
+func parsePlaceholder(contents string) (p placeholder, err error) {
+	kind, options := contents, ""
+	if i := strings.IndexByte(contents, ':'); i >= 0 {
+		kind, options = contents[:i], contents[i+1:]
+	}
+
+	switch placeholderKind(kind) {
+	case counterPlaceholder:
+		p = placeholder{
+			Kind:    counterPlaceholder,
+			Counter: Counter{Scope: ParentScope, Order: IndexOrder},
+			Start:   1,
+			Step:    1,
+		}
+		for _, option := range strings.Split(options, ",") {
+			if option == "" {
+				continue
+			}
+			pair := strings.SplitN(option, "=", 2)
+			if len(pair) != 2 {
+				return placeholder{}, fmt.Errorf("counter option \"%s\" is missing a value", option)
+			}
+			key, value := pair[0], pair[1]
+			switch key {
+			case "start":
+				p.Start, err = strconv.Atoi(value)
+			case "step":
+				p.Step, err = strconv.Atoi(value)
+			case "pad":
+				p.Pad, err = strconv.Atoi(value)
+				if err == nil && p.Pad < 0 {
+					err = fmt.Errorf("negative padding %d", p.Pad)
+				}
+			case "scope":
+				p.Counter.Scope, err = parseCounterScope(value)
+			case "order":
+				p.Counter.Order, err = parseCounterOrder(value)
+			default:
+				return placeholder{}, fmt.Errorf("unknown counter option \"%s\"", key)
+			}
+			if err != nil {
+				return placeholder{}, fmt.Errorf("invalid counter option \"%s\": %v", option, err)
+			}
+		}
+		return p, nil
+	case mtimePlaceholder:
+		if options == "" {
+			options = defaultTimeLayout
+		}
+		return placeholder{Kind: mtimePlaceholder, Layout: options}, nil
+	case sizePlaceholder, basePlaceholder, extPlaceholder:
+		if options != "" {
+			return placeholder{}, fmt.Errorf("placeholder \"%s\" does not accept options", kind)
+		}
+		return placeholder{Kind: placeholderKind(kind)}, nil
+	default:
+		return placeholder{}, fmt.Errorf("unknown placeholder \"%s\" in substitution", kind)
+	}
+}
+
+// Render returns the value of the placeholder for vars.
+func (p placeholder) Render(vars Vars) string {
+	switch p.Kind {
+	case counterPlaceholder:
+		n := p.Start + vars.Sequences[p.Counter]*p.Step
+		return fmt.Sprintf("%0*d", p.Pad, n)
+	case mtimePlaceholder:
+		return vars.ModTime.Format(p.Layout)
+	case sizePlaceholder:
+		return strconv.FormatInt(vars.Size, 10)
+	case basePlaceholder:
+		return strings.TrimSuffix(vars.Name, path.Ext(vars.Name))
+	case extPlaceholder:
+		return path.Ext(vars.Name)
+	default:
+		return ""
+	}
+}
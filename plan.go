@@ -0,0 +1,83 @@
+package refret
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Problem describes an action in a plan that cannot be carried out.
+type Problem struct {
+	Row    int
+	Action Action
+	Reason string
+}
+
+// String returns a string representation of the problem.
+func (p Problem) String() string {
+	return fmt.Sprintf("row %d: %s: %s", p.Row, p.Action, p.Reason)
+}
+
+// ValidatePlan checks each of the given actions in order against the
+// file system at root, as though the actions preceding it had already been
+// performed. It returns a problem for each action that could not be carried
+// out. Names are compared according to cs.
+//
+// If completed is non-nil, actions that are marked as completed are assumed
+// to have been carried out already and are skipped.
+//
+// Rows are numbered from 1, counting the notes and header row of the plan
+// file, so that they match the row numbers shown by a spreadsheet editor.
+// Actions that weren't read from a file are numbered as though the file had
+// no notes.
+func ValidatePlan(root string, cs CaseSensitivity, actions []Action, completed []bool) (problems []Problem, err error) {
+	overlay := NewOverlay(root, cs)
+	for i, action := range actions {
+		if completed != nil && completed[i] {
+			continue
+		}
+		row := action.Row
+		if row == 0 {
+			row = i + 2
+		}
+		if err := validateAction(action); err != nil {
+			problems = append(problems, Problem{Row: row, Action: action, Reason: err.Error()})
+			continue
+		}
+		switch err := overlay.Apply(action); err {
+		case nil:
+		case ErrSourceMissing, ErrTargetExists, ErrParentMissing, ErrTargetWithinSource, ErrNotDirectory, ErrDirectoryNotEmpty, ErrUnknownOperation:
+			problems = append(problems, Problem{Row: row, Action: action, Reason: err.Error()})
+		default:
+			return nil, err
+		}
+	}
+	return problems, nil
+}
+
+// validateAction returns an error if the paths of action are not appropriate
+// for its operation.
+func validateAction(action Action) error {
+	switch action.Operation() {
+	case RenameOperation:
+		if err := validatePath(action.OldPath); err != nil {
+			return err
+		}
+		if err := validatePath(action.NewPath); err != nil {
+			return err
+		}
+		if action.OldPath == action.NewPath {
+			return errors.New("path is unchanged")
+		}
+	case MkdirOperation:
+		if action.OldPath != "" {
+			return errors.New("mkdir action has a source path")
+		}
+		return validatePath(action.NewPath)
+	case RmdirOperation:
+		if action.NewPath != "" {
+			return errors.New("rmdir action has a target path")
+		}
+		return validatePath(action.OldPath)
+	}
+	return nil
+}
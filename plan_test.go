@@ -0,0 +1,152 @@
+package refret
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// makeTree creates the given slash-separated paths beneath a temporary
+// directory and returns it. Paths that end with a slash are created as
+// directories.
+func makeTree(t *testing.T, paths ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, p := range paths {
+		name := filepath.Join(root, filepath.FromSlash(p))
+		if p[len(p)-1] == '/' {
+			if err := os.MkdirAll(name, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// validate validates actions against root and returns the reason for each
+// problem, keyed by the index of its action.
+func validate(t *testing.T, root string, cs CaseSensitivity, actions []Action) map[int]string {
+	t.Helper()
+	problems, err := ValidatePlan(root, cs, actions, nil)
+	if err != nil {
+		t.Fatalf("validation failed: %v", err)
+	}
+	reasons := make(map[int]string)
+	for _, problem := range problems {
+		reasons[problem.Row-2] = problem.Reason
+	}
+	return reasons
+}
+
+func TestValidatePlanMovedParent(t *testing.T) {
+	root := makeTree(t, "a/x", "a/y")
+	actions := []Action{
+		{OldPath: "a", NewPath: "b"},
+		{OldPath: "b/x", NewPath: "b/z"},
+		{OldPath: "b", NewPath: "c"},
+		{OldPath: "c/z", NewPath: "z"}, // Moved twice with its parent
+		{OldPath: "c/y", NewPath: "y"}, // Never moved by itself
+		{OldPath: "c", Op: RmdirOperation},
+		{OldPath: "a/x", NewPath: "x"},  // No longer there
+		{OldPath: "b/y", NewPath: "y2"}, // No longer there
+	}
+	want := map[int]string{
+		6: ErrSourceMissing.Error(),
+		7: ErrSourceMissing.Error(),
+	}
+	if got := validate(t, root, CaseSensitive, actions); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected problems: got %v, want %v", got, want)
+	}
+}
+
+func TestValidatePlanSwap(t *testing.T) {
+	root := makeTree(t, "a", "b")
+	actions := []Action{
+		{OldPath: "a", NewPath: "a.refret-swap"},
+		{OldPath: "b", NewPath: "a"},
+		{OldPath: "a.refret-swap", NewPath: "b"},
+	}
+	if got := validate(t, root, CaseSensitive, actions); len(got) != 0 {
+		t.Errorf("unexpected problems: %v", got)
+	}
+}
+
+func TestValidatePlanMkdir(t *testing.T) {
+	root := makeTree(t, "Acme - 2020/report", "Acme/2020/", "Other/")
+	actions := []Action{
+		{OldPath: "Acme - 2020", NewPath: "Acme/2020"}, // Occupied in a directory that wasn't touched
+		{NewPath: "Archive", Op: MkdirOperation},
+		{NewPath: "Archive", Op: MkdirOperation}, // Already created
+		{OldPath: "Other", NewPath: "Archive/Other"},
+		{OldPath: "Acme - 2020", NewPath: "Missing/2020"},
+		{OldPath: "Acme - 2020/report", NewPath: "Archive/Other/report"},
+		{OldPath: "Acme - 2020", NewPath: "Archive/Other/report/2020"}, // Parent is a file
+	}
+	want := map[int]string{
+		0: ErrTargetExists.Error(),
+		2: ErrTargetExists.Error(),
+		4: ErrParentMissing.Error(),
+		6: ErrParentMissing.Error(),
+	}
+	if got := validate(t, root, CaseSensitive, actions); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected problems: got %v, want %v", got, want)
+	}
+}
+
+func TestValidatePlanRmdir(t *testing.T) {
+	root := makeTree(t, "full/report", "empty/", "file")
+	actions := []Action{
+		{OldPath: "full", Op: RmdirOperation},
+		{OldPath: "file", Op: RmdirOperation},
+		{OldPath: "empty", Op: RmdirOperation},
+		{OldPath: "empty", Op: RmdirOperation},
+		{OldPath: "full/report", NewPath: "report"},
+		{OldPath: "full", Op: RmdirOperation},
+	}
+	want := map[int]string{
+		0: ErrDirectoryNotEmpty.Error(),
+		1: ErrNotDirectory.Error(),
+		3: ErrSourceMissing.Error(),
+	}
+	if got := validate(t, root, CaseSensitive, actions); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected problems: got %v, want %v", got, want)
+	}
+}
+
+func TestValidatePlanWithinSource(t *testing.T) {
+	root := makeTree(t, "dir/")
+	actions := []Action{
+		{OldPath: "dir", NewPath: "dir/sub"},
+	}
+	want := map[int]string{0: ErrTargetWithinSource.Error()}
+	if got := validate(t, root, CaseSensitive, actions); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected problems: got %v, want %v", got, want)
+	}
+}
+
+func TestValidatePlanCaseOnly(t *testing.T) {
+	root := makeTree(t, "readme", "notes", "NOTES")
+	actions := []Action{
+		{OldPath: "readme", NewPath: "README"},
+		{OldPath: "notes", NewPath: "NOTES"},
+	}
+
+	want := map[int]string{1: ErrTargetExists.Error()}
+	if got := validate(t, root, CaseSensitive, actions); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected problems when case-sensitive: got %v, want %v", got, want)
+	}
+
+	// A case-insensitive file system can't hold both notes and NOTES, but
+	// the case-only rename of readme must still be allowed
+	if got := validate(t, root, CaseInsensitive, actions[:1]); len(got) != 0 {
+		t.Errorf("unexpected problems when case-insensitive: %v", got)
+	}
+}
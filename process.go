@@ -1,49 +1,98 @@
-package main
+package refret
 
 import (
 	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 )
 
-// process performs the given set of file rename actions and returns the
-// results.
-//
-// If progress is non-nil, records of actions taken will be sent on the
-// channel as they occur.
+// ActionCallback is a callback function that can be called for each action
+// as it is processed. The record describes the action, and includes its
+// error if it has been performed and failed.
+type ActionCallback func(index int, record Record)
+
+// ProcessOption is an option for Process.
+type ProcessOption func(*processor)
+
+// WithProgress returns an option that sends a record of each action on
+// progress after the action is performed.
+func WithProgress(progress chan<- Record) ProcessOption {
+	return func(p *processor) {
+		p.progress = progress
+	}
+}
+
+// BeforeAction returns an option that calls callback before each action is
+// performed.
+func BeforeAction(callback ActionCallback) ProcessOption {
+	return func(p *processor) {
+		p.before = callback
+	}
+}
+
+// AfterAction returns an option that calls callback after each action is
+// performed.
+func AfterAction(callback ActionCallback) ProcessOption {
+	return func(p *processor) {
+		p.after = callback
+	}
+}
+
+// WithFileSystem returns an option that performs actions on fsys instead of
+// the local file system.
+func WithFileSystem(fsys FileSystem) ProcessOption {
+	return func(p *processor) {
+		p.fsys = fsys
+	}
+}
+
+// processor holds the options for Process.
+type processor struct {
+	fsys     FileSystem
+	progress chan<- Record
+	before   ActionCallback
+	after    ActionCallback
+}
+
+// Process performs the given set of file system actions relative to root
+// and returns the results. Actions are performed on the local file system
+// unless another FileSystem is provided with WithFileSystem.
 //
 // If any error is returned, the set of completed records will be returned with it.
-func process(ctx context.Context, root string, actions []Action, progress chan<- Record) (results []Record, err error) {
+func Process(ctx context.Context, root string, actions []Action, options ...ProcessOption) (results []Record, err error) {
+	p := processor{fsys: OSFileSystem{}}
+	for _, option := range options {
+		option(&p)
+	}
+
 	for i, action := range actions {
 		if err := ctx.Err(); err != nil {
 			return results, err
 		}
 
-		// Combine the relative action paths with the root. Use filepath.Join
-		// here, because the paths need to make sense to the local file
-		// system.
-		from := filepath.Join(root, action.OldPath)
-		to := filepath.Join(root, action.NewPath)
-
-		// Let the user know what we're doing
-		fmt.Printf("Performing action %d: %s → %s\n", i, from, to)
-
-		// Perform the action and print an error if it failed
-		err := os.Rename(from, to)
+		// Combine the relative action paths with the root
+		from := rootedPath(root, action.OldPath)
+		to := rootedPath(root, action.NewPath)
 
 		// Marshal the result as a record
-		record := Record{OldPath: from, NewPath: to}
+		record := Record{OldPath: from, NewPath: to, Op: action.Operation()}
 
-		// Record and print an error if the action failed
-		if err != nil {
+		// Let the caller know what we're doing, then perform the action
+		if p.before != nil {
+			p.before(i, record)
+		}
+		if err := perform(p.fsys, record.Op, from, to); err != nil {
 			record.Error = err.Error()
-			fmt.Printf("  FAILED: %v\n", err)
+		}
+		if p.after != nil {
+			p.after(i, record)
 		}
 
 		// Send the record to the progress channel for logging
-		if progress != nil {
-			progress <- record
+		if p.progress != nil {
+			p.progress <- record
 		}
 
 		// Apppend the record to the result set
@@ -51,3 +100,102 @@ func process(ctx context.Context, root string, actions []Action, progress chan<-
 	}
 	return results, nil
 }
+
+// perform carries out a single operation on fsys, after making sure that
+// its source still exists and its target is free.
+func perform(fsys FileSystem, op Operation, from, to string) error {
+	switch op {
+	case RenameOperation:
+		if filepath.Dir(from) == filepath.Dir(to) && isCaseOnly(filepath.Base(from), filepath.Base(to)) {
+			return renameCaseOnly(fsys, from, to)
+		}
+		if err := verify(fsys, from, to); err != nil {
+			return err
+		}
+		return fsys.Rename(from, to)
+	case MkdirOperation:
+		if err := verify(fsys, "", to); err != nil {
+			return err
+		}
+		return fsys.Mkdir(to, 0755)
+	case RmdirOperation:
+		if err := verify(fsys, from, ""); err != nil {
+			return err
+		}
+		if fi, err := fsys.Stat(from); err != nil {
+			return err
+		} else if !fi.IsDir() {
+			return fmt.Errorf("not a directory: %s", from)
+		}
+		return fsys.Remove(from)
+	default:
+		return fmt.Errorf("unknown operation: %s", op)
+	}
+}
+
+// renameCaseOnly renames from to to when their names differ only by case.
+// On case-insensitive file systems a direct rename may fail or have no
+// effect, so the file is moved to a temporary name first.
+func renameCaseOnly(fsys FileSystem, from, to string) error {
+	source, err := fsys.Stat(from)
+	if err != nil {
+		return err
+	}
+	if target, err := fsys.Stat(to); err == nil {
+		if !sameFile(source, target) {
+			return fmt.Errorf("target already exists: %s", to)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	temp := from + ".refret-case"
+	for i := 2; ; i++ {
+		if _, err := fsys.Stat(temp); os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return err
+		}
+		temp = from + ".refret-case-" + strconv.Itoa(i)
+	}
+
+	if err := fsys.Rename(from, temp); err != nil {
+		return err
+	}
+	if err := fsys.Rename(temp, to); err != nil {
+		fsys.Rename(temp, from) // Try to put the file back where it was
+		return err
+	}
+	return nil
+}
+
+// verify returns an error if no file exists in fsys at from, or if a file already
+// exists at to. Empty paths are not checked.
+func verify(fsys FileSystem, from, to string) error {
+	if from != "" {
+		if _, err := fsys.Stat(from); err != nil {
+			return err
+		}
+	}
+	if to != "" {
+		if _, err := fsys.Stat(to); err == nil {
+			return fmt.Errorf("target already exists: %s", to)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// rootedPath combines a slash-separated path relative to root with the
+// root itself. It uses filepath.Join, because the combined path needs to make
+// sense to the local file system.
+//
+// Empty paths are returned as-is, because they indicate that an action has
+// no source or no target.
+func rootedPath(root, p string) string {
+	if p == "" {
+		return ""
+	}
+	return filepath.Join(root, p)
+}
@@ -0,0 +1,386 @@
+package refret
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testRoot is the root beneath which test files are added to memory file
+// systems.
+const testRoot = "/data"
+
+// mapRenamer renames the files at the slash-separated paths it holds, and
+// leaves all other files as they are.
+type mapRenamer map[string]string
+
+func (r mapRenamer) Rename(file File) Outcome {
+	newName, ok := r[path.Join(file.Parent, file.Name)]
+	if !ok {
+		newName = file.Name
+	}
+	return Outcome{Result: Matched, NewName: newName, Contents: r}
+}
+
+// scanFiles scans fsys with renamer and adds the scanned files to a new memory
+// file system beneath testRoot.
+func scanFiles(t *testing.T, fsys fstest.MapFS, renamer Renamer, cs CaseSensitivity) ([]File, *MemoryFileSystem) {
+	t.Helper()
+	files, err := NewScanner(fsys, renamer).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	m := NewMemoryFileSystem(cs)
+	if err := m.AddFiles(testRoot, files); err != nil {
+		t.Fatalf("failed to add files: %v", err)
+	}
+	return files, m
+}
+
+// contents returns the contents of m beneath testRoot as a map of
+// slash-separated paths to file sizes. Directories have a size of -1.
+func contents(t *testing.T, m *MemoryFileSystem) map[string]int64 {
+	t.Helper()
+	root, err := m.lookup(splitMemoryPath(testRoot))
+	if err != nil {
+		t.Fatalf("failed to find root: %v", err)
+	}
+	result := make(map[string]int64)
+	var walk func(node *memoryNode, dir string)
+	walk = func(node *memoryNode, dir string) {
+		for _, child := range node.children {
+			p := path.Join(dir, child.name)
+			if child.IsDir() {
+				result[p] = -1
+				walk(child, p)
+			} else {
+				result[p] = child.size
+			}
+		}
+	}
+	walk(root, "")
+	return result
+}
+
+// process performs actions on m and fails the test if any of them fail.
+func process(t *testing.T, m *MemoryFileSystem, actions []Action) {
+	t.Helper()
+	results, err := Process(context.Background(), testRoot, actions, WithFileSystem(m))
+	if err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	for _, record := range results {
+		if record.Error != "" {
+			t.Errorf("%s failed: %s", record.Action(), record.Error)
+		}
+	}
+}
+
+// data returns file contents of the given length.
+func data(size int) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(strings.Repeat("x", size))}
+}
+
+func TestProcessSwap(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a": data(1),
+		"b": data(2),
+	}
+	files, m := scanFiles(t, fsys, mapRenamer{"a": "b", "b": "a"}, CaseSensitive)
+	actions := BuildActions(files, CaseSensitive)
+	if len(actions) != 3 {
+		t.Fatalf("expected 3 actions for a swap, got %d: %v", len(actions), actions)
+	}
+	process(t, m, actions)
+
+	want := map[string]int64{"a": 2, "b": 1}
+	if got := contents(t, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected contents after swap: got %v, want %v", got, want)
+	}
+}
+
+func TestProcessCycle(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a": data(1),
+		"b": data(2),
+		"c": data(3),
+		"d": data(4),
+	}
+	files, m := scanFiles(t, fsys, mapRenamer{"a": "b", "b": "c", "c": "a", "d": "e"}, CaseSensitive)
+	process(t, m, BuildActions(files, CaseSensitive))
+
+	want := map[string]int64{"a": 3, "b": 1, "c": 2, "e": 4}
+	if got := contents(t, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected contents after cycle: got %v, want %v", got, want)
+	}
+}
+
+func TestProcessChain(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a": data(1),
+		"b": data(2),
+	}
+	files, m := scanFiles(t, fsys, mapRenamer{"a": "b", "b": "c"}, CaseSensitive)
+	process(t, m, BuildActions(files, CaseSensitive))
+
+	want := map[string]int64{"b": 1, "c": 2}
+	if got := contents(t, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected contents after chain: got %v, want %v", got, want)
+	}
+}
+
+func TestProcessMkdir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Acme - 2020/report": data(1),
+		"Acme - 2021/report": data(2),
+		"Other/report":       data(3),
+	}
+	renamer := mapRenamer{
+		"Acme - 2020": "Acme/2020",
+		"Acme - 2021": "Acme/2021",
+		"Other":       "Archive/Other",
+	}
+	files, m := scanFiles(t, fsys, renamer, CaseSensitive)
+	actions := BuildActions(files, CaseSensitive)
+
+	var mkdirs []string
+	for _, action := range actions {
+		if action.Operation() == MkdirOperation {
+			mkdirs = append(mkdirs, action.NewPath)
+		}
+	}
+	sort.Strings(mkdirs)
+	if want := []string{"Acme", "Archive"}; !reflect.DeepEqual(mkdirs, want) {
+		t.Errorf("unexpected mkdir actions: got %v, want %v", mkdirs, want)
+	}
+
+	process(t, m, actions)
+
+	want := map[string]int64{
+		"Acme":                 -1,
+		"Acme/2020":            -1,
+		"Acme/2020/report":     1,
+		"Acme/2021":            -1,
+		"Acme/2021/report":     2,
+		"Archive":              -1,
+		"Archive/Other":        -1,
+		"Archive/Other/report": 3,
+	}
+	if got := contents(t, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected contents after mkdir: got %v, want %v", got, want)
+	}
+}
+
+func TestProcessRmdir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"empty":       &fstest.MapFile{Mode: fs.ModeDir | 0755},
+		"full/report": data(1),
+	}
+	_, m := scanFiles(t, fsys, mapRenamer{}, CaseSensitive)
+
+	results, err := Process(context.Background(), testRoot, []Action{
+		{OldPath: "empty", Op: RmdirOperation},
+		{OldPath: "full", Op: RmdirOperation},
+		{OldPath: "full/report", Op: RmdirOperation},
+	}, WithFileSystem(m))
+	if err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if results[0].Error != "" {
+		t.Errorf("failed to remove empty directory: %s", results[0].Error)
+	}
+	if results[1].Error == "" {
+		t.Errorf("removed a directory that isn't empty")
+	}
+	if results[2].Error == "" {
+		t.Errorf("removed a file with rmdir")
+	}
+
+	want := map[string]int64{"full": -1, "full/report": 1}
+	if got := contents(t, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected contents after rmdir: got %v, want %v", got, want)
+	}
+}
+
+func TestProcessMkdirRmdirReverse(t *testing.T) {
+	_, m := scanFiles(t, fstest.MapFS{}, mapRenamer{}, CaseSensitive)
+	process(t, m, []Action{
+		{NewPath: "new", Op: MkdirOperation},
+		{NewPath: "new/nested", Op: MkdirOperation},
+	})
+	want := map[string]int64{"new": -1, "new/nested": -1}
+	if got := contents(t, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected contents after mkdir: got %v, want %v", got, want)
+	}
+
+	process(t, m, []Action{
+		{OldPath: "new/nested", Op: RmdirOperation},
+		{OldPath: "new", Op: RmdirOperation},
+	})
+	if got := contents(t, m); len(got) != 0 {
+		t.Errorf("unexpected contents after rmdir: %v", got)
+	}
+}
+
+func TestProcessCaseOnly(t *testing.T) {
+	for _, cs := range []CaseSensitivity{CaseSensitive, CaseInsensitive} {
+		t.Run(cs.String(), func(t *testing.T) {
+			fsys := fstest.MapFS{
+				"readme":         data(1),
+				"Photos/img.jpg": data(2),
+			}
+			renamer := mapRenamer{"readme": "README", "Photos": "photos", "Photos/img.jpg": "img.JPG"}
+			files, m := scanFiles(t, fsys, renamer, cs)
+			actions := BuildActions(files, cs)
+			if len(actions) != 3 {
+				t.Fatalf("expected 3 actions for case-only renames, got %d: %v", len(actions), actions)
+			}
+			process(t, m, actions)
+
+			want := map[string]int64{"README": 1, "photos": -1, "photos/img.JPG": 2}
+			if got := contents(t, m); !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected contents after case-only renames: got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestProcessCaseOnlyOccupied(t *testing.T) {
+	// On a case-sensitive file system, a case-only rename must not replace
+	// a different file that already has the new name
+	fsys := fstest.MapFS{
+		"readme": data(1),
+		"README": data(2),
+	}
+	_, m := scanFiles(t, fsys, mapRenamer{}, CaseSensitive)
+
+	results, err := Process(context.Background(), testRoot, []Action{
+		{OldPath: "readme", NewPath: "README", Op: RenameOperation},
+	}, WithFileSystem(m))
+	if err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	if results[0].Error == "" {
+		t.Errorf("case-only rename replaced an existing file")
+	}
+
+	want := map[string]int64{"readme": 1, "README": 2}
+	if got := contents(t, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected contents after failed rename: got %v, want %v", got, want)
+	}
+}
+
+func TestProcessMissingSource(t *testing.T) {
+	_, m := scanFiles(t, fstest.MapFS{"a": data(1)}, mapRenamer{}, CaseSensitive)
+
+	results, err := Process(context.Background(), testRoot, []Action{
+		{OldPath: "missing", NewPath: "b", Op: RenameOperation},
+		{OldPath: "missing", Op: RmdirOperation},
+		{OldPath: "a", NewPath: "c", Op: RenameOperation},
+	}, WithFileSystem(m))
+	if err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	for _, record := range results[:2] {
+		if record.Error == "" {
+			t.Errorf("%s succeeded without a source", record.Action())
+		}
+	}
+	if results[2].Error != "" {
+		t.Errorf("%s failed after an earlier failure: %s", results[2].Action(), results[2].Error)
+	}
+
+	want := map[string]int64{"c": 1}
+	if got := contents(t, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected contents: got %v, want %v", got, want)
+	}
+}
+
+func TestProcessOccupiedTarget(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a":   data(1),
+		"b":   data(2),
+		"dir": &fstest.MapFile{Mode: fs.ModeDir | 0755},
+	}
+	_, m := scanFiles(t, fsys, mapRenamer{}, CaseInsensitive)
+
+	results, err := Process(context.Background(), testRoot, []Action{
+		{OldPath: "a", NewPath: "b", Op: RenameOperation},
+		{OldPath: "a", NewPath: "B", Op: RenameOperation},
+		{NewPath: "DIR", Op: MkdirOperation},
+	}, WithFileSystem(m))
+	if err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	for _, record := range results {
+		if !strings.Contains(record.Error, "already exists") {
+			t.Errorf("%s: expected an error about the existing target, got %q", record.Action(), record.Error)
+		}
+	}
+
+	want := map[string]int64{"a": 1, "b": 2, "dir": -1}
+	if got := contents(t, m); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected contents: got %v, want %v", got, want)
+	}
+}
+
+func TestProcessCancelled(t *testing.T) {
+	_, m := scanFiles(t, fstest.MapFS{"a": data(1)}, mapRenamer{}, CaseSensitive)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := Process(ctx, testRoot, []Action{
+		{OldPath: "a", NewPath: "b", Op: RenameOperation},
+	}, WithFileSystem(m))
+	if err == nil {
+		t.Errorf("process succeeded after being cancelled")
+	}
+	if len(results) != 0 {
+		t.Errorf("process performed %d actions after being cancelled", len(results))
+	}
+}
+
+// shallowRenamer renames the files at the root that it holds, and doesn't
+// traverse any directories.
+type shallowRenamer map[string]string
+
+func (r shallowRenamer) Rename(file File) Outcome {
+	newName, ok := r[file.Name]
+	if !ok {
+		newName = file.Name
+	}
+	return Outcome{Result: Matched, NewName: newName}
+}
+
+func TestSimulateUnscanned(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Acme - 2020/report": data(1),
+		"Acme - 2021/report": data(2),
+		"Acme/2020/report":   data(3),
+	}
+	files, err := NewScanner(fsys, shallowRenamer{"Acme - 2020": "Acme/2020", "Acme - 2021": "Acme/2021"}).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	actions := BuildActions(files, CaseSensitive)
+	results, err := Simulate(context.Background(), fsys, testRoot, files, CaseSensitive, actions)
+	if err != nil {
+		t.Fatalf("simulation failed: %v", err)
+	}
+
+	failed := make(map[string]bool)
+	for _, record := range results {
+		failed[record.Action().String()] = record.Error != ""
+	}
+	if !failed[path.Join(testRoot, "Acme - 2020")+" → "+path.Join(testRoot, "Acme/2020")] {
+		t.Errorf("simulation moved a directory over one that wasn't scanned: %v", results)
+	}
+	if failed[path.Join(testRoot, "Acme - 2021")+" → "+path.Join(testRoot, "Acme/2021")] {
+		t.Errorf("simulation failed to move a directory into one that wasn't scanned: %v", results)
+	}
+}
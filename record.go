@@ -1,17 +1,33 @@
-package main
+package refret
 
 // Record is a migration record describing actions taken on a particular
 // file or folder.
+//
+// A record with an empty operation is treated as a rename, for
+// compatibility with files that lack an operation column.
 type Record struct {
 	OldPath string
 	NewPath string
+	Op      Operation
 	Error   string
 }
 
+// Action returns the action that was taken by r.
+func (r Record) Action() Action {
+	return Action{OldPath: r.OldPath, NewPath: r.NewPath, Op: r.Op}
+}
+
 // String returns a string representation of the record.
 func (r Record) String() string {
 	if r.Error != "" {
-		return "FAIL: " + r.OldPath + " → " + r.NewPath + ": " + r.Error
+		return "FAIL: " + r.Action().String() + ": " + r.Error
+	}
+	switch r.Action().Operation() {
+	case MkdirOperation:
+		return "MKDIR: " + r.NewPath
+	case RmdirOperation:
+		return "RMDIR: " + r.OldPath
+	default:
+		return "MOVE: " + r.OldPath + " → " + r.NewPath
 	}
-	return "MOVE: " + r.OldPath + " → " + r.NewPath
 }
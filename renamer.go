@@ -0,0 +1,113 @@
+package refret
+
+// Renamer decides whether each scanned file matches, and what its new name
+// should be.
+//
+// Custom renamers can be supplied to a Scanner in place of patterns. Rename
+// is called from multiple goroutines at once, so implementations must be
+// safe for concurrent use.
+type Renamer interface {
+	// Rename returns the outcome for file, which includes its depth and
+	// metadata.
+	Rename(file File) Outcome
+}
+
+// Finisher is an optional interface that can be implemented by a Renamer
+// that needs to see all of the scanned files before their names are final.
+// The scanner calls Finish once, after all files have been scanned.
+type Finisher interface {
+	Finish(files []File)
+}
+
+// MetadataRenamer is an optional interface that can be implemented by a
+// Renamer to report whether it needs the metadata of files, other than their
+// names and types. Retrieving metadata can require a separate request for
+// each file on some file systems, so the scanner only does so for renamers
+// that need it. Renamers that don't implement this interface are always
+// given metadata.
+type MetadataRenamer interface {
+	Renamer
+	NeedsMetadata() bool
+}
+
+// needsMetadata returns true if renamer needs the metadata of files.
+func needsMetadata(renamer Renamer) bool {
+	if r, ok := renamer.(MetadataRenamer); ok {
+		return r.NeedsMetadata()
+	}
+	return true
+}
+
+// Outcome is the result of applying a Renamer to a file.
+type Outcome struct {
+	Result  Match
+	NewName string
+	Rule    string // Describes the rule that produced the new name, for review
+	Reason  string // Describes why the file was not matched, for review
+
+	// Contents is the renamer for the contents of a directory. If it is
+	// nil, the contents are not scanned.
+	Contents Renamer
+}
+
+// Patterns is a sequence of patterns that apply to successive depths of a
+// file system. It is the Renamer used by the command line.
+type Patterns []Pattern
+
+// Rename applies the patterns to a file at the root of the file system.
+func (patterns Patterns) Rename(file File) Outcome {
+	return positionRenamer{patterns: patterns, positions: StartPositions(patterns)}.Rename(file)
+}
+
+// NeedsMetadata returns true if any of the patterns need the metadata of
+// files.
+func (patterns Patterns) NeedsMetadata() bool {
+	for _, pattern := range patterns {
+		if pattern.NeedsMetadata() {
+			return true
+		}
+	}
+	return false
+}
+
+// Finish numbers the files matched by patterns with counter placeholders.
+func (patterns Patterns) Finish(files []File) {
+	NumberFiles(files, patterns)
+}
+
+// positionRenamer applies the patterns at a set of positions, which are
+// determined by the patterns that matched the parent directories of a file.
+type positionRenamer struct {
+	patterns  Patterns
+	positions []int
+}
+
+// NeedsMetadata returns true if any of the patterns need the metadata of
+// files.
+func (r positionRenamer) NeedsMetadata() bool {
+	return r.patterns.NeedsMetadata()
+}
+
+// Rename applies the patterns at r's positions to file.
+func (r positionRenamer) Rename(file File) Outcome {
+	var outcome Outcome
+	var next []int
+	outcome.Result, outcome.NewName, _, outcome.Rule, next = ApplyPattern(r.patterns, r.positions, file.Vars())
+	switch outcome.Result {
+	case Matched:
+		if len(next) > 0 {
+			outcome.Contents = positionRenamer{patterns: r.patterns, positions: next}
+		}
+	case NotMatched:
+		for _, position := range r.positions {
+			if position >= len(r.patterns) {
+				continue
+			}
+			if exclusion, excluded := r.patterns[position].Excludes(file.Name); excluded {
+				outcome.Reason = ExcludedReason + exclusion.String()
+				break
+			}
+		}
+	}
+	return outcome
+}
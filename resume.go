@@ -0,0 +1,121 @@
+package refret
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// CompletedActions determines which of the given actions have already
+// succeeded according to records. The actions are relative to root, as
+// they would be in a plan.
+//
+// Recorded paths are compared relative to root, so the root doesn't need to
+// be spelled the same way it was when the records were made. A trailing
+// separator, a relative path or a path through a symbolic link all refer to
+// the same root.
+//
+// It returns a slice that indicates whether each action has completed,
+// along with the records of the completed actions.
+func CompletedActions(root string, actions []Action, records []Record) (completed []bool, prior []Record) {
+	// Collect the successful records for each pair of relative paths
+	resolver := newRootResolver(root)
+	succeeded := make(map[Action][]Record)
+	for _, record := range records {
+		if record.Error != "" {
+			continue
+		}
+		oldPath, ok := resolver.Relative(record.OldPath)
+		if !ok {
+			continue
+		}
+		newPath, ok := resolver.Relative(record.NewPath)
+		if !ok {
+			continue
+		}
+		key := Action{OldPath: oldPath, NewPath: newPath, Op: record.Action().Operation()}
+		succeeded[key] = append(succeeded[key], record)
+	}
+
+	// Match each action to a successful record
+	completed = make([]bool, len(actions))
+	for i, action := range actions {
+		key := Action{OldPath: action.OldPath, NewPath: action.NewPath, Op: action.Operation()}
+		if matches := succeeded[key]; len(matches) > 0 {
+			succeeded[key] = matches[1:]
+			completed[i] = true
+			prior = append(prior, matches[0])
+		}
+	}
+
+	return completed, prior
+}
+
+// rootResolver converts paths on the local file system into slash-separated
+// paths relative to a root.
+type rootResolver struct {
+	roots []string // Equivalent spellings of the root
+}
+
+// newRootResolver returns a resolver for root.
+func newRootResolver(root string) rootResolver {
+	r := rootResolver{roots: []string{filepath.Clean(root)}}
+	if abs, err := filepath.Abs(root); err == nil {
+		r.roots = append(r.roots, abs)
+		if real, err := filepath.EvalSymlinks(abs); err == nil && real != abs {
+			r.roots = append(r.roots, real)
+		}
+	}
+	return r
+}
+
+// Relative returns p relative to the root. It returns false if p is not
+// within the root. Empty paths are returned as-is, because they indicate that
+// an action has no source or no target.
+func (r rootResolver) Relative(p string) (string, bool) {
+	if p == "" {
+		return "", true
+	}
+	if rel, ok := r.relative(filepath.Clean(p)); ok {
+		return rel, true
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", false
+	}
+	if rel, ok := r.relative(abs); ok {
+		return rel, true
+	}
+	return r.relative(resolveSymlinks(abs))
+}
+
+// relative returns p relative to any of the spellings of the root.
+func (r rootResolver) relative(p string) (string, bool) {
+	for _, root := range r.roots {
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return filepath.ToSlash(rel), true
+	}
+	return "", false
+}
+
+// resolveSymlinks returns the absolute path p with any symbolic links in its
+// deepest existing directory resolved. The rest of p is left as-is, because
+// it may refer to files that have since been moved.
+func resolveSymlinks(p string) string {
+	for dir := p; ; {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			rest, err := filepath.Rel(dir, p)
+			if err != nil {
+				return p
+			}
+			return filepath.Join(real, rest)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return p
+		}
+		dir = parent
+	}
+}
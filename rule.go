@@ -0,0 +1,58 @@
+package refret
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RuleMode determines how the rules of a pattern are applied.
+type RuleMode int
+
+// Rule modes
+const (
+	FirstMatch RuleMode = 0 // Apply the first rule that matches
+	Chain      RuleMode = 1 // Apply each rule that matches in turn
+)
+
+// String returns a string representation of mode.
+func (mode RuleMode) String() string {
+	switch mode {
+	case Chain:
+		return "Chained"
+	default:
+		return "First Match"
+	}
+}
+
+// DepthRule is an alternative rule for the pattern at a particular depth.
+type DepthRule struct {
+	Depth int
+	Rule  Pattern
+}
+
+// UnmarshalText unmarshals the given text as a depth, followed by a colon
+// and a pattern.
+func (dr *DepthRule) UnmarshalText(text []byte) error {
+	pair := strings.SplitN(string(text), ":", 2)
+	if len(pair) != 2 {
+		return fmt.Errorf("rule \"%s\" must be prefixed with a depth and a colon", text)
+	}
+	depth, err := strconv.Atoi(pair[0])
+	if err != nil || depth < 0 {
+		return fmt.Errorf("rule \"%s\" has an invalid depth \"%s\"", text, pair[0])
+	}
+	var rule Pattern
+	if err := rule.UnmarshalText([]byte(pair[1])); err != nil {
+		return err
+	}
+	switch {
+	case rule.Recursive:
+		return fmt.Errorf("rule \"%s\" can't be recursive", text)
+	case rule.Expression == nil:
+		return fmt.Errorf("rule \"%s\" must have an expression", text)
+	}
+	dr.Depth = depth
+	dr.Rule = rule
+	return nil
+}
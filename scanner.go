@@ -1,4 +1,4 @@
-package main
+package refret
 
 import (
 	"context"
@@ -13,28 +13,58 @@ import (
 // it is scanned.
 type ScanCallback func(file File)
 
+// DefaultConcurrency is the maximum number of concurrent read operations
+// performed by a scanner unless another limit is provided.
+const DefaultConcurrency = 32
+
+// ScanOption is an option for NewScanner.
+type ScanOption func(*Scanner)
+
+// WithCallback returns an option that calls callback for each file scanned,
+// in order.
+func WithCallback(callback ScanCallback) ScanOption {
+	return func(s *Scanner) {
+		s.callback = callback
+	}
+}
+
+// WithConcurrency returns an option that limits the number of concurrent
+// read operations performed while scanning.
+func WithConcurrency(concurrency int) ScanOption {
+	return func(s *Scanner) {
+		s.pool = NewPool(concurrency)
+	}
+}
+
 // Scanner scans file systems for matching files.
 type Scanner struct {
 	root     fs.FS
-	patterns []Pattern
+	renamer  Renamer
 	callback ScanCallback
 	pool     *Pool
 }
 
-// NewScanner prepares a new scanner for the given file system and pattern.
-//
-// If callback is supplied, it will be called for each file scanned in order.
-func NewScanner(root fs.FS, patterns []Pattern, callback ScanCallback, concurrency int) *Scanner {
-	return &Scanner{
-		root:     root,
-		patterns: patterns,
-		callback: callback,
-		pool:     NewPool(concurrency),
+// NewScanner prepares a new scanner for the given file system. The renamer
+// determines which files match and what their new names should be. To scan
+// for files that match a set of patterns, supply them as Patterns.
+func NewScanner(root fs.FS, renamer Renamer, options ...ScanOption) *Scanner {
+	s := &Scanner{
+		root:    root,
+		renamer: renamer,
+		pool:    NewPool(DefaultConcurrency),
 	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
 }
 
 // Scan returns the result of scanning for files based on the given
 // configuration.
+//
+// If a callback was supplied, it sees the names of files before the renamer
+// has finished with them, such as files matched by patterns with counter
+// placeholders before they have been numbered.
 func (s Scanner) Scan(ctx context.Context) (files []File, err error) {
 	entries, err := fs.ReadDir(s.root, ".")
 	if err != nil {
@@ -46,7 +76,9 @@ func (s Scanner) Scan(ctx context.Context) (files []File, err error) {
 		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
-		files[i] = NewFile(s.patterns, 0, i, entries[i], "", "")
+		if files[i], err = NewFile(s.renamer, 0, i, entries[i], "", ""); err != nil {
+			return nil, fmt.Errorf("failed to scan root: %v", err)
+		}
 	}
 
 	group, ctx := errgroup.WithContext(ctx)
@@ -55,6 +87,11 @@ func (s Scanner) Scan(ctx context.Context) (files []File, err error) {
 		return nil, err
 	}
 
+	// Let the renamer finish its work, now that all of the files are known
+	if finisher, ok := s.renamer.(Finisher); ok {
+		finisher.Finish(files)
+	}
+
 	return files, nil
 }
 
@@ -131,7 +168,11 @@ func (s Scanner) enumerate(ctx context.Context, g *errgroup.Group, file *File) (
 				c <- err
 				return
 			}
-			contents[i] = NewFile(s.patterns, file.Depth+1, i, entries[i], path.Join(file.Parent, file.Name), path.Join(file.NewParent, file.NewName))
+			contents[i], err = NewFile(file.contents, file.Depth+1, i, entries[i], path.Join(file.Parent, file.Name), path.Join(file.NewParent, file.NewName))
+			if err != nil {
+				c <- fmt.Errorf("failed to collect contents of subdirectory: %v", err)
+				return
+			}
 		}
 
 		file.Contents = contents
@@ -139,8 +180,14 @@ func (s Scanner) enumerate(ctx context.Context, g *errgroup.Group, file *File) (
 	return c, nil
 }
 
+// shouldTraverse returns true if the contents of file should be scanned.
+// Only directories for which the renamer supplied a renamer for their
+// contents are traversed. Symbolic links are never followed.
 func (s Scanner) shouldTraverse(file File) bool {
-	return file.IsDir && file.Result == Matched && (file.Depth+1 < len(s.patterns))
+	if file.Mode&fs.ModeSymlink != 0 {
+		return false
+	}
+	return file.IsDir && file.contents != nil
 }
 
 func countDescendantsMatched(files []File) int {
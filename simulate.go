@@ -0,0 +1,76 @@
+package refret
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+)
+
+// Simulate performs actions against an in-memory copy of the scanned files
+// beneath root, in the same way that Process would perform them against the
+// local file system, and returns a record of each action. Nothing on disk is
+// modified.
+//
+// The files are expected to have been scanned from fsys, which holds the
+// contents of root. Any directories that weren't traversed by the scan are
+// read from fsys when the simulation needs them, so that actions that
+// depend on files that weren't scanned are simulated faithfully.
+//
+// Names are compared according to cs.
+func Simulate(ctx context.Context, fsys fs.FS, root string, files []File, cs CaseSensitivity, actions []Action, options ...ProcessOption) (results []Record, err error) {
+	m := NewMemoryFileSystem(cs)
+	if err := m.Mount(root, fsys); err != nil {
+		return nil, err
+	}
+	if err := m.AddFiles(root, files); err != nil {
+		return nil, err
+	}
+	options = append(options, WithFileSystem(m))
+	return Process(ctx, root, actions, options...)
+}
+
+// AddFiles adds the scanned files beneath root and their contents to m,
+// along with their metadata. The root itself is added as a directory, even
+// if it is empty.
+//
+// The contents of root and of each directory that was traversed by the scan
+// are considered complete. If a file system has been mounted at root, the
+// contents of any other directories are read from it when they are needed.
+// Files that vanished during the scan are left out.
+func (m *MemoryFileSystem) AddFiles(root string, files []File) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	dir, err := m.mkdirAll(splitMemoryPath(root), false)
+	if err != nil {
+		return &fs.PathError{Op: "add", Path: root, Err: err}
+	}
+	dir.loaded = true
+	return m.addFiles(dir, rootedPath(root, "."), files)
+}
+
+// addFiles adds files and their contents to dir, which has the local path p.
+func (m *MemoryFileSystem) addFiles(dir *memoryNode, p string, files []File) error {
+	for _, file := range files {
+		if file.Reason == VanishedReason {
+			continue
+		}
+		name := filepath.Join(p, file.Name)
+		node, exists := dir.children[m.cs.Key(file.Name)]
+		switch {
+		case !exists:
+			node = dir.newChild(file.Name, file.Mode)
+			dir.attach(m.cs, node)
+		case !node.IsDir() || !file.Mode.IsDir():
+			return &fs.PathError{Op: "add", Path: name, Err: fs.ErrExist}
+		}
+		node.mode, node.size, node.modTime = file.Mode, file.Size, file.ModTime
+		if file.IsDir && file.Contents != nil {
+			node.loaded = true
+			if err := m.addFiles(node, name, file.Contents); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package refret
+
+import (
+	"io/fs"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// caseOp is a case transformation operator within a substitution.
+type caseOp int
+
+// Case transformation operators
+const (
+	noCaseOp    caseOp = 0
+	upperOp     caseOp = 1 // \U: Convert to upper case until \L or \E
+	lowerOp     caseOp = 2 // \L: Convert to lower case until \U or \E
+	upperNextOp caseOp = 3 // \u: Convert the next character to upper case
+	lowerNextOp caseOp = 4 // \l: Convert the next character to lower case
+	endOp       caseOp = 5 // \E: End case conversion
+)
+
+// Vars holds the values describing a file that are available to
+// placeholders in a substitution and to conditions.
+type Vars struct {
+	Name      string          // The name of the file
+	Mode      fs.FileMode     // The mode of the file
+	Size      int64           // The size of the file in bytes
+	ModTime   time.Time       // The modification time of the file
+	Sequences map[Counter]int // The position of a file within each counter's sequence
+}
+
+// substitutionPart is a portion of a substitution. Each part either holds
+// a case transformation operator, template text that may reference capture
+// groups, or a placeholder.
+type substitutionPart struct {
+	Op          caseOp
+	Text        string
+	Placeholder *placeholder
+}
+
+// substitution is a substitution template that has been broken into parts.
+type substitution []substitutionPart
+
+// parseSubstitution breaks a substitution into parts. It recognizes the
+// case transformation operators \U, \L, \u, \l and \E, placeholders enclosed
+// in braces, and the escape sequences \\, \{ and \} for literal characters.
+// All other text is kept as-is.
+//
+// Braces are only treated as a placeholder when they enclose the name of a
+// known placeholder kind, optionally followed by a colon and options, so
+// that other braces in existing substitutions keep their literal meaning.
+// Braces that follow a dollar sign are part of a capture group reference
+// such as ${1}, and a doubled dollar sign is a literal dollar sign, so $${n}
+// is a dollar sign followed by a placeholder.
+//
+// If the substitution is invalid, the index of the problem is returned along
+// with an error.
+func parseSubstitution(s string) (sub substitution, index int, err error) {
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			sub = append(sub, substitutionPart{Text: text.String()})
+			text.Reset()
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$' && i+1 < len(s) && s[i+1] == '$':
+			text.WriteString("$$")
+			i++
+		case c == '$' && i+1 < len(s) && s[i+1] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				text.WriteByte(c) // A malformed reference is literal text
+				continue
+			}
+			text.WriteString(s[i : i+end+1])
+			i += end
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 || !isPlaceholder(s[i+1:i+end]) {
+				text.WriteByte(c)
+				continue
+			}
+			p, err := parsePlaceholder(s[i+1 : i+end])
+			if err != nil {
+				return nil, i, err
+			}
+			flush()
+			sub = append(sub, substitutionPart{Placeholder: &p})
+			i += end
+		case c == '\\' && i+1 < len(s):
+			var op caseOp
+			switch s[i+1] {
+			case 'U':
+				op = upperOp
+			case 'L':
+				op = lowerOp
+			case 'u':
+				op = upperNextOp
+			case 'l':
+				op = lowerNextOp
+			case 'E':
+				op = endOp
+			case '\\', '{', '}':
+				text.WriteByte(s[i+1])
+				i++
+				continue
+			default:
+				text.WriteByte(c)
+				continue
+			}
+			flush()
+			sub = append(sub, substitutionPart{Op: op})
+			i++
+		default:
+			text.WriteByte(c)
+		}
+	}
+	flush()
+	return sub, 0, nil
+}
+
+// Counters returns the counters used by the substitution's placeholders.
+func (s substitution) Counters() (counters []Counter) {
+	for _, part := range s {
+		if part.Placeholder != nil && part.Placeholder.Kind == counterPlaceholder {
+			counters = append(counters, part.Placeholder.Counter)
+		}
+	}
+	return counters
+}
+
+// NeedsMetadata returns true if the substitution's placeholders use the
+// size or modification time of a file.
+func (s substitution) NeedsMetadata() bool {
+	for _, part := range s {
+		if part.Placeholder == nil {
+			continue
+		}
+		switch part.Placeholder.Kind {
+		case mtimePlaceholder, sizePlaceholder:
+			return true
+		}
+	}
+	return false
+}
+
+// Replace returns a copy of src in which each match of re has been replaced
+// by the substitution. Capture groups are expanded as they would be by
+// re.ReplaceAllString, placeholders are filled in from vars, then case
+// transformations are applied.
+func (s substitution) Replace(re *regexp.Regexp, src string, vars Vars) string {
+	var out strings.Builder
+	last := 0
+	for _, match := range re.FindAllStringSubmatchIndex(src, -1) {
+		out.WriteString(src[last:match[0]])
+		out.WriteString(s.expand(re, src, match, vars))
+		last = match[1]
+	}
+	out.WriteString(src[last:])
+	return out.String()
+}
+
+// expand returns the substitution for a single match.
+func (s substitution) expand(re *regexp.Regexp, src string, match []int, vars Vars) string {
+	var (
+		out  strings.Builder
+		mode caseOp // The conversion in effect
+		next caseOp // The conversion for the next character
+	)
+	for _, part := range s {
+		var text string
+		switch {
+		case part.Placeholder != nil:
+			text = part.Placeholder.Render(vars)
+		case part.Op == upperOp || part.Op == lowerOp:
+			mode = part.Op
+		case part.Op == upperNextOp || part.Op == lowerNextOp:
+			next = part.Op
+		case part.Op == endOp:
+			mode, next = noCaseOp, noCaseOp
+		default:
+			text = string(re.ExpandString(nil, part.Text, src, match))
+		}
+
+		switch mode {
+		case upperOp:
+			text = strings.ToUpper(text)
+		case lowerOp:
+			text = strings.ToLower(text)
+		}
+		if next != noCaseOp && text != "" {
+			r, size := utf8.DecodeRuneInString(text)
+			if next == upperNextOp {
+				r = unicode.ToUpper(r)
+			} else {
+				r = unicode.ToLower(r)
+			}
+			text = string(r) + text[size:]
+			next = noCaseOp
+		}
+		out.WriteString(text)
+	}
+	return out.String()
+}
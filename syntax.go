@@ -0,0 +1,184 @@
+package refret
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sedPrefix marks a pattern written in the alternative sed:s|exp|sub|flags
+// syntax.
+const sedPrefix = "sed:"
+
+// delimiters is the set of characters that may delimit the parts of a
+// pattern written in the alternative sed:s|exp|sub|flags syntax.
+const delimiters = "/|#!,:;@%~="
+
+// PatternError describes a problem with the syntax of a pattern.
+type PatternError struct {
+	Pattern string
+	Column  int // The column of the problem, starting at 1
+	Message string
+}
+
+// Error returns a string representation of the error.
+func (e *PatternError) Error() string {
+	return fmt.Sprintf("pattern \"%s\": column %d: %s", e.Pattern, e.Column, e.Message)
+}
+
+// patternSyntax holds the parts of a pattern and the columns at which the
+// runes of each part appear in the pattern as written. Each slice of columns
+// has an extra entry for the column that follows the part, so that problems
+// at the end of a part can be reported.
+type patternSyntax struct {
+	Expression   string
+	Substitution string
+	Flags        string
+
+	ExpressionColumns   []int
+	SubstitutionColumns []int
+	FlagsColumns        []int
+}
+
+// column returns the column of the rune at index within a part, given the
+// columns of the part's runes.
+func column(columns []int, index int) int {
+	switch {
+	case len(columns) == 0:
+		return 0
+	case index < 0:
+		return columns[0]
+	case index >= len(columns):
+		return columns[len(columns)-1]
+	default:
+		return columns[index]
+	}
+}
+
+// offsetColumns returns a copy of columns with offset added to each.
+func offsetColumns(columns []int, offset int) []int {
+	shifted := make([]int, len(columns))
+	for i, c := range columns {
+		shifted[i] = c + offset
+	}
+	return shifted
+}
+
+// sequentialColumns returns the columns of a part that is written without
+// escapes and starts at column start.
+func sequentialColumns(part string, start int) []int {
+	columns := make([]int, len([]rune(part))+1)
+	for i := range columns {
+		columns[i] = start + i
+	}
+	return columns
+}
+
+// parsePattern breaks a pattern into its parts.
+//
+// Patterns are written in one of two forms. The first form is exp/sub, where
+// the substitution is optional. Further forward slashes are considered part
+// of the substitution, so that it can move files into subdirectories. The
+// substitution must not be empty if the slash is present. Flags can't be
+// provided in this form, because they would be indistinguishable from the
+// name of a subdirectory.
+//
+// The second form is sed:s|exp|sub|flags, where the vertical bar can be any
+// one of the characters in delimiters. All three delimiters are required, but
+// the substitution and flags may be empty. The delimiter has no special
+// meaning elsewhere in this form. The sed: prefix keeps this form from being
+// confused with a regular expression that happens to start with s.
+//
+// In both forms, a delimiter can be included in the expression or
+// substitution by escaping it with a backslash. All other backslashes are
+// left in place.
+func parsePattern(text string) (syntax patternSyntax, err error) {
+	runes := []rune(text)
+	fail := func(column int, format string, args ...interface{}) (patternSyntax, error) {
+		return patternSyntax{}, &PatternError{Pattern: text, Column: column, Message: fmt.Sprintf(format, args...)}
+	}
+
+	// The alternative form
+	if strings.HasPrefix(text, sedPrefix) {
+		start := len([]rune(sedPrefix))
+		if len(runes) < start+2 || runes[start] != 's' || !strings.ContainsRune(delimiters, runes[start+1]) {
+			return fail(start+1, "expected s followed by one of the delimiters \"%s\"", delimiters)
+		}
+		delim := runes[start+1]
+		parts, columns, err := splitPattern(text, start+2, delim)
+		if err != nil {
+			return patternSyntax{}, err
+		}
+		switch {
+		case len(parts) < 3:
+			return fail(len(runes)+1, "missing delimiter \"%c\"", delim)
+		case len(parts) > 3:
+			return fail(column(columns[2], len(columns[2])), "unexpected delimiter \"%c\"", delim)
+		}
+		return patternSyntax{
+			Expression:          parts[0],
+			Substitution:        parts[1],
+			Flags:               parts[2],
+			ExpressionColumns:   columns[0],
+			SubstitutionColumns: columns[1],
+			FlagsColumns:        columns[2],
+		}, nil
+	}
+
+	// The original form
+	parts, columns, err := splitPattern(text, 0, '/')
+	if err != nil {
+		return patternSyntax{}, err
+	}
+	syntax.Expression = parts[0]
+	syntax.ExpressionColumns = columns[0]
+	if len(parts) == 1 {
+		return syntax, nil
+	}
+
+	// Join the rest of the parts into the substitution, including the
+	// columns of the slashes between them
+	syntax.Substitution = strings.Join(parts[1:], "/")
+	for _, part := range columns[1:] {
+		syntax.SubstitutionColumns = append(syntax.SubstitutionColumns, part...)
+	}
+	if syntax.Substitution == "" {
+		return fail(column(columns[1], 0), "empty substitution provided in pattern")
+	}
+	return syntax, nil
+}
+
+// splitPattern splits text, starting at the rune index start, on each
+// occurrence of delim that is not escaped by a backslash. Escaped delimiters
+// are unescaped. It also returns the columns at which the runes of each part
+// appear in text, followed by the column of the delimiter or end that
+// follows the part.
+func splitPattern(text string, start int, delim rune) (parts []string, columns [][]int, err error) {
+	runes := []rune(text)
+	var part []rune
+	var partColumns []int
+	for i := start; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\':
+			if i+1 >= len(runes) {
+				return nil, nil, &PatternError{Pattern: text, Column: i + 1, Message: "incomplete escape sequence"}
+			}
+			if runes[i+1] != delim {
+				part = append(part, '\\')
+				partColumns = append(partColumns, i+1)
+			}
+			i++
+			part = append(part, runes[i])
+			partColumns = append(partColumns, i+1)
+		case r == delim:
+			parts = append(parts, string(part))
+			columns = append(columns, append(partColumns, i+1))
+			part, partColumns = nil, nil
+		default:
+			part = append(part, r)
+			partColumns = append(partColumns, i+1)
+		}
+	}
+	parts = append(parts, string(part))
+	columns = append(columns, append(partColumns, len(runes)+1))
+	return parts, columns, nil
+}
@@ -1,39 +1,83 @@
-package main
+package refret
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/gocarina/gocsv"
 )
 
-func writeActions(out string, actions []Action) error {
+// WriteActions writes actions to a TSV file. Each of the notes is written
+// on its own line, prefixed by a number sign, before the header row.
+func WriteActions(out string, notes []string, actions []Action) error {
 	f, err := os.Create(out)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
+	if err := writeNotes(f, notes); err != nil {
+		return err
+	}
 	w := csv.NewWriter(f)
 	w.Comma = '\t'
 	return gocsv.MarshalCSV(actions, w)
 }
 
-func writeOmitted(out string, omitted []Omit) error {
+// WriteOmitted writes the actions that were omitted from a plan to a TSV
+// file, preceded by notes as in WriteActions.
+func WriteOmitted(out string, notes []string, omitted []Omit) error {
 	f, err := os.Create(out)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
+	if err := writeNotes(f, notes); err != nil {
+		return err
+	}
 	w := csv.NewWriter(f)
 	w.Comma = '\t'
 	return gocsv.MarshalCSV(omitted, w)
 }
 
-func writeRecordStream(out string, records <-chan Record) (done <-chan error, err error) {
+// WriteRecords writes records to a results file, preceded by notes as in
+// WriteActions.
+func WriteRecords(out string, notes []string, records []Record) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeNotes(f, notes); err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Comma = '\t'
+	return gocsv.MarshalCSV(records, w)
+}
+
+// WriteRecordStream creates a results file and writes notes to it as in
+// WriteActions, then writes each record received from records as it
+// arrives.
+//
+// The caller owns records and must close it once every record has been
+// sent. done receives nil after records is closed and every record has
+// been written, or the error as soon as writing fails, and is then closed.
+func WriteRecordStream(out string, notes []string, records <-chan Record) (done <-chan error, err error) {
 	f, err := os.Create(out)
 	if err != nil {
 		return nil, err
 	}
+	if err := writeNotes(f, notes); err != nil {
+		f.Close()
+		return nil, err
+	}
 	completion := make(chan error)
 	proxy := make(chan interface{})
 	go func() {
@@ -51,3 +95,177 @@ func writeRecordStream(out string, records <-chan Record) (done <-chan error, er
 	}()
 	return completion, nil
 }
+
+// WriteCollisions writes collisions to a TSV file, preceded by notes as in
+// WriteActions.
+func WriteCollisions(out string, notes []string, collisions []Collision) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeNotes(f, notes); err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Comma = '\t'
+	return gocsv.MarshalCSV(collisions, w)
+}
+
+// writeNotes writes each of the notes on its own line, prefixed by a number
+// sign. Notes precede the header of a TSV file, and are skipped when the
+// file is read. Spreadsheet editors show them as rows above the header, so
+// row numbers reported for a file count them.
+func writeNotes(w io.Writer, notes []string) error {
+	for _, note := range notes {
+		if _, err := fmt.Fprintf(w, "# %s\n", note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadRecords reads the records in a results file.
+//
+// If a run was interrupted, the last line of its results file may have been
+// only partially written. That line is ignored.
+func ReadRecords(in string) (records []Record, err error) {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return nil, err
+	}
+	if end := bytes.LastIndexByte(data, '\n'); end+1 < len(data) {
+		data = data[:end+1]
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	body, _ := skipNotes(skipBOM(bytes.NewReader(data)))
+	r := csv.NewReader(body)
+	r.Comma = '\t'
+	if err := gocsv.UnmarshalCSV(r, &records); err != nil {
+		return nil, err
+	}
+	for i := range records {
+		records[i].Op = records[i].Action().Operation()
+	}
+	return records, nil
+}
+
+// ReadActions reads the actions in a TSV file written by WriteActions or
+// edited in a spreadsheet. Notes are skipped, and the row of each action
+// counts them and the header, so that it matches the row shown by a
+// spreadsheet editor.
+func ReadActions(in string) (actions []Action, err error) {
+	f, err := os.Open(in)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	body, notes := skipNotes(skipBOM(f))
+	r := csv.NewReader(body)
+	r.Comma = '\t'
+	if err := gocsv.UnmarshalCSV(r, &actions); err != nil {
+		return nil, err
+	}
+	for i := range actions {
+		actions[i].Op = actions[i].Operation()
+		actions[i].Row = notes + i + 2 // Count the notes and the header
+	}
+	return actions, nil
+}
+
+// skipNotes returns a reader that skips the notes written by writeNotes,
+// if any are present. It also returns the number of notes that were
+// skipped, so that row numbers can account for them.
+func skipNotes(r io.Reader) (body io.Reader, notes int) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err != nil || b[0] != '#' {
+			return br, notes
+		}
+		if _, err := br.ReadString('\n'); err != nil {
+			return br, notes
+		}
+		notes++
+	}
+}
+
+// skipBOM returns a reader that skips the UTF-8 byte order mark that is
+// sometimes added by spreadsheet editors, if one is present.
+func skipBOM(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(3); err == nil && bytes.Equal(b, []byte{0xEF, 0xBB, 0xBF}) {
+		br.Discard(3)
+	}
+	return br
+}
+
+// WriteMappingRows writes rows of a mapping table to a TSV file.
+func WriteMappingRows(out string, notes []string, rows []MappingRow) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeNotes(f, notes); err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Comma = '\t'
+	return gocsv.MarshalCSV(rows, w)
+}
+
+// ReadMapping reads the rows of a mapping table from a TSV file, or from a
+// CSV file if its name ends in ".csv". The file must have a header row that
+// names an Old and a New column. Other columns and empty rows are ignored.
+func ReadMapping(in string) (rows []MappingRow, err error) {
+	f, err := os.Open(in)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(skipBOM(f))
+	r.Comma = '\t'
+	if strings.EqualFold(filepath.Ext(in), ".csv") {
+		r.Comma = ','
+	}
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("mapping file is empty")
+	}
+
+	// Find the columns in the header
+	oldColumn, newColumn := -1, -1
+	for i, name := range records[0] {
+		switch {
+		case strings.EqualFold(strings.TrimSpace(name), "Old"):
+			oldColumn = i
+		case strings.EqualFold(strings.TrimSpace(name), "New"):
+			newColumn = i
+		}
+	}
+	if oldColumn < 0 || newColumn < 0 {
+		return nil, errors.New("mapping file must have Old and New columns")
+	}
+
+	field := func(record []string, column int) string {
+		if column < len(record) {
+			return record[column]
+		}
+		return ""
+	}
+	for _, record := range records[1:] {
+		row := MappingRow{Old: field(record, oldColumn), New: field(record, newColumn)}
+		if row.Old == "" && row.New == "" {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,22 @@
+package refret
+
+// BuildUndoActions prepares a set of actions that reverse the successful
+// actions described by records.
+//
+// The actions are returned in reverse order, so that the last action taken
+// is the first to be undone. Created directories are removed, and removed
+// directories are created.
+func BuildUndoActions(records []Record) (actions []Action) {
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		if record.Error != "" {
+			continue
+		}
+		actions = append(actions, Action{
+			OldPath: record.NewPath,
+			NewPath: record.OldPath,
+			Op:      record.Action().Operation().Reverse(),
+		})
+	}
+	return actions
+}
@@ -1,4 +1,4 @@
-package main
+package refret
 
 // FileFilter is a function that returns true for files that should be
 // included in a result set.